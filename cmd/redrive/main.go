@@ -0,0 +1,50 @@
+// redrive возвращает сообщения из dead-letter топика в основной топик заказов
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+	"github.com/MikhaylovMaks/wb_techl0/internal/kafka"
+	"github.com/MikhaylovMaks/wb_techl0/internal/pii"
+	"github.com/MikhaylovMaks/wb_techl0/pkg/logger"
+)
+
+func main() {
+	limit := flag.Int("limit", 0, "max messages to redrive (0 — all)")
+	idle := flag.Duration("idle", 10*time.Second, "stop after no new messages for this long")
+	group := flag.String("group", "orders-dlq-redrive", "consumer group for the dlq topic")
+	flag.Parse()
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	if cfg.Kafka.DLQTopic == "" {
+		log.Fatal("kafka.dlq_topic is not set")
+	}
+	l, _, err := logger.NewLogger(cfg.Log, pii.RedactText)
+	if err != nil {
+		log.Fatalf("logger: %v", err)
+	}
+	defer l.Sync()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	r := kafka.NewRedriver(cfg.Kafka, *group, l)
+	n, err := r.Run(ctx, *limit, *idle)
+	if cerr := r.Close(); cerr != nil {
+		l.Errorw("failed to close redriver", "err", cerr)
+	}
+	if err != nil {
+		l.Fatalw("redrive failed", "redriven", n, "err", err)
+	}
+	l.Infow("redrive completed", "redriven", n, "from", cfg.Kafka.DLQTopic, "to", cfg.Kafka.Topic)
+}
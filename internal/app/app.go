@@ -2,19 +2,29 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/MikhaylovMaks/wb_techl0/internal/codec"
 	"github.com/MikhaylovMaks/wb_techl0/internal/config"
 	"github.com/MikhaylovMaks/wb_techl0/internal/handlers"
 	"github.com/MikhaylovMaks/wb_techl0/internal/kafka"
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/pii"
 	"github.com/MikhaylovMaks/wb_techl0/internal/repository/postgres"
 	"github.com/MikhaylovMaks/wb_techl0/internal/storage"
 	"github.com/MikhaylovMaks/wb_techl0/pkg/database"
 	"github.com/MikhaylovMaks/wb_techl0/pkg/logger"
+	"github.com/MikhaylovMaks/wb_techl0/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"go.uber.org/zap"
 )
 
@@ -27,28 +37,42 @@ func New() *App {
 }
 
 func (a *App) Run() error {
+	// config
+	cfg, err := config.NewConfig()
+	if err != nil {
+		return err
+	}
+	a.cfg = cfg
+
 	// инициализация логгера
-	log, err := logger.NewLogger()
+	log, logLevel, err := logger.NewLogger(cfg.Log, pii.RedactText)
 	if err != nil {
 		return err
 	}
 	defer log.Sync()
 	log.Info("service starting...")
 
-	// создаём контекст с возможностью отмены
-	ctx, cancel := context.WithCancel(context.Background())
+	// создаём контекст с возможностью отмены; логгер из контекста получают все слои
+	ctx, cancel := context.WithCancel(logger.WithContext(context.Background(), log))
 	defer cancel()
 
 	// graceful shutdown
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 
-	// config
-	cfg, err := config.NewConfig()
+	// tracing
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
 	if err != nil {
 		return err
 	}
-	a.cfg = cfg
+	defer func() {
+		// отправляем оставшиеся спаны
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Errorw("failed to flush traces", "err", err)
+		}
+	}()
 
 	// db
 	db, err := database.NewPostgres(ctx, cfg.Postgres)
@@ -56,29 +80,67 @@ func (a *App) Run() error {
 		return err
 	}
 	defer db.Close()
-	repo := postgres.NewRepository(db.Pool)
+	onConflict, err := postgres.ParseConflictPolicy(cfg.Postgres.OnConflict)
+	if err != nil {
+		return err
+	}
+	repo := postgres.NewRepository(db.Pool, onConflict)
 
 	// cache
-	cache := storage.NewMemoryStorage()
+	switch cfg.Cache.DBChanges {
+	case "off", "invalidate", "refresh":
+	default:
+		return fmt.Errorf("unknown cache db_changes mode %q", cfg.Cache.DBChanges)
+	}
+	if err := checkJanitor(cfg.Cache); err != nil {
+		return err
+	}
+	cache, closeCache, err := newCache(ctx, cfg, log)
+	if err != nil {
+		return err
+	}
+	defer closeCache()
 
-	// прогреваем кэш
-	if err := warmUpCache(ctx, log, repo, cache); err != nil {
-		log.Fatalf("cache warm-up failed: %v", err)
+	// восстанавливаем кэш из снимка, а если не вышло — прогреваем из БД
+	snapshotPath := cfg.Cache.SnapshotPath
+	if _, ok := cache.(storage.Ranger); !ok && snapshotPath != "" {
+		log.Warnw("cache snapshots are not supported by backend", "backend", cfg.Cache.Backend)
+		snapshotPath = ""
 	}
+	if snapshotPath == "" || !restoreCache(ctx, log, repo, cache, snapshotPath, cfg.Cache.WarmUp) {
+		// без прогрева сервис работает, просто первые запросы пойдут в БД
+		if err := warmUpCache(ctx, log, repo, cache, cfg.Cache.WarmUp); err != nil {
+			log.Errorw("cache warm-up failed", "err", err)
+		}
+	}
+
+	// статистика обращений к кэшу для /admin/cache/stats
+	instrumented := storage.NewInstrumentedCache(cache)
 
 	// kafka
-	consumer := kafka.NewConsumer(
-		[]string{cfg.Kafka.Broker},
-		cfg.Kafka.Topic,
-		cfg.Kafka.GroupID,
-		repo,
-		cache,
-		log,
-	)
-	producer := kafka.NewProducer([]string{cfg.Kafka.Broker}, cfg.Kafka.Topic, log)
+	switch cfg.Kafka.Ordering {
+	case kafka.OrderingPartition, kafka.OrderingKey:
+	default:
+		return fmt.Errorf("unknown kafka ordering %q", cfg.Kafka.Ordering)
+	}
+	if cfg.Outbox.Topic != "" && cfg.Outbox.Interval <= 0 {
+		return fmt.Errorf("outbox interval must be positive, got %s", cfg.Outbox.Interval)
+	}
+	codecs, err := newCodecs(cfg)
+	if err != nil {
+		return err
+	}
+	// метрики отдаются HTTP-сервером на /metrics
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	consumer := kafka.NewConsumer(cfg.Kafka, codecs, repo, instrumented, kafka.NewMetrics(registry), log)
+	producer := kafka.NewProducer([]string{cfg.Kafka.Broker}, cfg.Kafka.Topic, codecs.Default(), log)
 
 	// http server
-	server := handlers.NewServer(cfg.Server.Port, repo, cache, log)
+	if err := handlers.CheckRoles(cfg.Server); err != nil {
+		return err
+	}
+	server := handlers.NewServer(cfg.Server, repo, instrumented, registry, logLevel, log)
 
 	var wg sync.WaitGroup
 	// запускаем consumer в отдельной горутин
@@ -87,6 +149,48 @@ func (a *App) Run() error {
 		defer wg.Done()
 		consumer.Start(ctx)
 	}()
+	// публикуем события о сохранённых заказах из outbox
+	if cfg.Outbox.Topic != "" {
+		relay := kafka.NewRelay(cfg.Outbox, cfg.Kafka.Broker, cfg.Kafka.Producer, repo, log)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			relay.Start(ctx)
+		}()
+	}
+	// запускаем очистку кэша от просроченных записей
+	if expirable, ok := cache.(storage.Expirable); ok && localTTL(cfg.Cache) > 0 {
+		janitor := storage.NewJanitor(expirable, cfg.Cache.JanitorInterval, cfg.Cache.RefreshAhead, repo.GetOrderByUID, log)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			janitor.Start(ctx)
+		}()
+	}
+	// в двухуровневом режиме слушаем инвалидации от других реплик
+	if tiered, ok := cache.(*storage.TieredStorage); ok {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tiered.Start(ctx)
+		}()
+	}
+	// сбрасываем или перечитываем закэшированные заказы, изменённые прямо в БД
+	if cfg.Cache.DBChanges != "off" {
+		var loader storage.Loader
+		if cfg.Cache.DBChanges == "refresh" {
+			loader = repo.GetOrderByUID
+		}
+		invalidator := storage.NewInvalidator(cache, loader, log)
+		listener := postgres.NewOrderListener(database.ConnString(cfg.Postgres), log)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			listener.Listen(ctx, func(orderUID string, changeSeq int64) {
+				invalidator.OrderChanged(ctx, orderUID, changeSeq)
+			})
+		}()
+	}
 	// запускаем producer в отдельной горутине
 	wg.Add(1)
 	go func() {
@@ -112,29 +216,215 @@ func (a *App) Run() error {
 	_ = server.Shutdown(shutdownCtx)
 
 	wg.Wait()
+	if snapshotPath != "" {
+		saveSnapshot(log, repo, cache.(storage.Ranger), snapshotPath)
+	}
 	log.Info("service stopped")
 	return nil
 }
 
-// warmUpCache — предварительно загружает заказы из БД в кэш
-func warmUpCache(ctx context.Context, log *zap.SugaredLogger, repo postgres.OrderRepository, cache storage.Cache) error {
-	warmCtx, warmCancel := context.WithTimeout(ctx, 10*time.Second)
-	uids, err := repo.GetAllOrderUIDs(warmCtx)
-	warmCancel()
+// newCache — создаёт кэш выбранного в настройках типа; возвращаемая функция освобождает его ресурсы
+func newCache(ctx context.Context, cfg *config.Config, log *zap.SugaredLogger) (storage.Cache, func(), error) {
+	noop := func() {}
+	switch cfg.Cache.Backend {
+	case "memory", "":
+		local, err := newLocalCache(cfg.Cache, cfg.Cache.TTL)
+		return local, noop, err
+	case "redis", "tiered":
+	default:
+		return nil, noop, fmt.Errorf("unknown cache backend %q", cfg.Cache.Backend)
+	}
+
+	rdb, err := database.NewRedis(ctx, cfg.Redis)
 	if err != nil {
-		log.Errorw("failed to warm cache: get uids", "err", err)
-		return err
+		return nil, noop, err
 	}
-	for _, uid := range uids {
-		orderCtx, orderCancel := context.WithTimeout(ctx, 5*time.Second)
-		order, err := repo.GetOrderByUID(orderCtx, uid)
-		orderCancel()
-		if err != nil {
-			log.Errorw("failed to warm cache: get order", "order_uid", uid, "err", err)
-			return err
-		}
-		cache.Set(uid, order)
+	closeRedis := func() { _ = rdb.Close() }
+	remote := storage.NewRedisStorage(rdb, cfg.Redis.KeyPrefix, cfg.Cache.TTL, log)
+	if cfg.Cache.Backend == "redis" {
+		return remote, closeRedis, nil
+	}
+
+	local, err := newLocalCache(cfg.Cache, localTTL(cfg.Cache))
+	if err != nil {
+		closeRedis()
+		return nil, noop, err
+	}
+	return storage.NewTieredStorage(local, remote, log), closeRedis, nil
+}
+
+// localTTL — срок жизни записей кэша, который чистит janitor: в двухуровневом режиме — локального уровня
+// (local_ttl, по умолчанию ttl), иначе ttl
+func localTTL(cfg config.Cache) time.Duration {
+	if cfg.Backend == "tiered" && cfg.LocalTTL > 0 {
+		return cfg.LocalTTL
+	}
+	return cfg.TTL
+}
+
+// checkJanitor — записи с истекающим сроком без janitor копятся в памяти, поэтому его интервал обязателен
+func checkJanitor(cfg config.Cache) error {
+	if localTTL(cfg) > 0 && cfg.JanitorInterval <= 0 {
+		return fmt.Errorf("cache janitor_interval must be positive when entries expire, got %s", cfg.JanitorInterval)
 	}
-	log.Infow("cache warm-up completed", "count", len(uids))
 	return nil
 }
+
+// newCodecs — форматы сообщений Kafka; реестр схем подключается, только если задан его адрес
+func newCodecs(cfg *config.Config) (*codec.Set, error) {
+	var registry *codec.RegistryClient
+	if cfg.SchemaRegistry.URL != "" {
+		registry = codec.NewRegistryClient(cfg.SchemaRegistry.URL, &http.Client{Timeout: cfg.SchemaRegistry.Timeout})
+	}
+	subject := cfg.SchemaRegistry.Subject
+	if subject == "" {
+		subject = cfg.Kafka.Topic + "-value"
+	}
+	return codec.NewSet(cfg.Kafka.Format, cfg.Kafka.Producer, registry, subject)
+}
+
+// newLocalCache — кэш в памяти: без лимитов и шардирования используется обычная MemoryStorage
+func newLocalCache(cfg config.Cache, ttl time.Duration) (storage.Expirable, error) {
+	if cfg.Shards > 1 {
+		return storage.NewShardedStorage(cfg.Shards, cfg.MaxEntries, cfg.MaxBytes, storage.EvictionPolicy(cfg.Policy), ttl)
+	}
+	if cfg.MaxEntries == 0 && cfg.MaxBytes == 0 {
+		return storage.NewMemoryStorageWithTTL(ttl), nil
+	}
+	return storage.NewBoundedStorage(cfg.MaxEntries, cfg.MaxBytes, storage.EvictionPolicy(cfg.Policy), ttl)
+}
+
+// restoreCache — загружает кэш из снимка, убирает удалённые после него заказы и догружает из БД созданные
+// или изменённые. Снимок отбрасывается, если отметка изменений в БД меньше его отметки (база пересоздана).
+// Возвращает false, если кэш нужно прогреть целиком
+func restoreCache(ctx context.Context, log *zap.SugaredLogger, repo postgres.OrderRepository, cache storage.Cache, path string, cfg config.WarmUp) bool {
+	dbCtx, dbCancel := context.WithTimeout(ctx, 10*time.Second)
+	dbHighWater, err := repo.ChangeWatermark(dbCtx)
+	dbCancel()
+	if err != nil {
+		log.Warnw("failed to restore cache: get high-water mark", "err", err)
+		return false
+	}
+
+	highWater, restored, err := storage.ReadSnapshot(path, cache.Set)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Infow("cache snapshot not found", "path", path)
+		} else {
+			log.Warnw("failed to read cache snapshot", "path", path, "err", err)
+		}
+		cache.InvalidateAll()
+		return false
+	}
+	if dbHighWater < highWater {
+		log.Warnw("cache snapshot is newer than database, discarding",
+			"snapshot_high_water", highWater, "db_high_water", dbHighWater)
+		cache.InvalidateAll()
+		return false
+	}
+
+	// удалённые после снимка заказы убираем до догрузки: заказ могли удалить и создать заново
+	dbCtx, dbCancel = context.WithTimeout(ctx, 10*time.Second)
+	deleted, err := repo.DeletedSince(dbCtx, highWater)
+	dbCancel()
+	if err != nil {
+		log.Warnw("failed to restore cache: get deleted orders", "err", err)
+		cache.InvalidateAll()
+		return false
+	}
+	for _, uid := range deleted {
+		cache.Invalidate(uid)
+	}
+
+	fillCtx, fillCancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer fillCancel()
+	caughtUp, err := fillCache(fillCtx, log, repo, cache, postgres.OrderFilter{ChangedSince: highWater}, cfg)
+	if err != nil {
+		log.Warnw("failed to restore cache: load new orders", "err", err)
+		cache.InvalidateAll()
+		return false
+	}
+	log.Infow("cache restored from snapshot", "path", path, "restored", restored, "deleted", len(deleted), "caught_up", caughtUp)
+	return true
+}
+
+// saveSnapshot — сохраняет кэш в файл вместе с отметкой изменений заказов в БД
+func saveSnapshot(log *zap.SugaredLogger, repo postgres.OrderRepository, cache storage.Ranger, path string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	highWater, err := repo.ChangeWatermark(ctx)
+	cancel()
+	if err != nil {
+		log.Errorw("failed to save cache snapshot: get high-water mark", "err", err)
+		return
+	}
+	n, err := storage.WriteSnapshot(path, cache, highWater)
+	if err != nil {
+		log.Errorw("failed to save cache snapshot", "path", path, "err", err)
+		return
+	}
+	log.Infow("cache snapshot saved", "path", path, "count", n, "high_water", highWater)
+}
+
+// warmUpCache — предварительно загружает в кэш заказы согласно политике прогрева
+func warmUpCache(ctx context.Context, log *zap.SugaredLogger, repo postgres.OrderRepository, cache storage.Cache, cfg config.WarmUp) error {
+	warmCtx, warmCancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer warmCancel()
+
+	filter := postgres.OrderFilter{Limit: cfg.Limit}
+	if cfg.Days > 0 {
+		filter.CreatedAfter = time.Now().AddDate(0, 0, -cfg.Days)
+	}
+	_, err := fillCache(warmCtx, log, repo, cache, filter, cfg)
+	return err
+}
+
+// fillCache — потоково читает заказы по фильтру и раскладывает их по кэшу в cfg.Workers горутин.
+// Заказы, которые не удалось собрать, пропускаются и попадают в лог
+func fillCache(ctx context.Context, log *zap.SugaredLogger, repo postgres.OrderRepository, cache storage.Cache, filter postgres.OrderFilter, cfg config.WarmUp) (int, error) {
+	workers := max(cfg.Workers, 1)
+	orders := make(chan *models.Order, cfg.PageSize)
+	var loaded atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for order := range orders {
+				cache.Set(order.OrderUID, order)
+				loaded.Add(1)
+			}
+		}()
+	}
+
+	start := time.Now()
+	lastReport := start
+	var broken int
+	err := repo.StreamOrders(ctx, filter, cfg.PageSize, func(page []postgres.StreamedOrder) error {
+		for _, so := range page {
+			if so.Err != nil {
+				broken++
+				log.Warnw("skipping broken order", "order_uid", so.OrderUID, "err", so.Err)
+				continue
+			}
+			select {
+			case orders <- so.Order:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if time.Since(lastReport) >= 5*time.Second {
+			lastReport = time.Now()
+			log.Infow("cache fill progress", "loaded", loaded.Load(), "broken", broken)
+		}
+		return nil
+	})
+	close(orders)
+	wg.Wait()
+
+	log.Infow("cache fill completed",
+		"loaded", loaded.Load(),
+		"broken", broken,
+		"dur_ms", time.Since(start).Milliseconds(),
+	)
+	return int(loaded.Load()), err
+}
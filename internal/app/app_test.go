@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/repository/postgres"
+	"github.com/MikhaylovMaks/wb_techl0/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestLocalTTL(t *testing.T) {
+	assert.Equal(t, time.Hour, localTTL(config.Cache{Backend: "memory", TTL: time.Hour, LocalTTL: time.Minute}))
+	assert.Equal(t, time.Minute, localTTL(config.Cache{Backend: "tiered", TTL: time.Hour, LocalTTL: time.Minute}))
+	assert.Equal(t, time.Hour, localTTL(config.Cache{Backend: "tiered", TTL: time.Hour}))
+	// общий TTL не задан, но локальный уровень всё равно истекает
+	assert.Equal(t, time.Minute, localTTL(config.Cache{Backend: "tiered", LocalTTL: time.Minute}))
+}
+
+func TestCheckJanitor(t *testing.T) {
+	assert.NoError(t, checkJanitor(config.Cache{Backend: "memory"}))
+	assert.Error(t, checkJanitor(config.Cache{Backend: "memory", TTL: time.Hour}))
+	assert.NoError(t, checkJanitor(config.Cache{Backend: "memory", TTL: time.Hour, JanitorInterval: time.Minute}))
+	// tiered с ttl 0 и local_ttl: записи локального уровня истекают, janitor нужен
+	assert.Error(t, checkJanitor(config.Cache{Backend: "tiered", LocalTTL: time.Minute}))
+	assert.NoError(t, checkJanitor(config.Cache{Backend: "tiered", LocalTTL: time.Minute, JanitorInterval: time.Minute}))
+}
+
+// snapshotRepo — БД после снимка: заказ "2" удалён, "3" создан
+type snapshotRepo struct {
+	postgres.OrderRepository
+	watermark int64
+	filter    postgres.OrderFilter
+	since     int64
+}
+
+func (r *snapshotRepo) ChangeWatermark(context.Context) (int64, error) { return r.watermark, nil }
+
+func (r *snapshotRepo) DeletedSince(_ context.Context, watermark int64) ([]string, error) {
+	r.since = watermark
+	return []string{"2"}, nil
+}
+
+func (r *snapshotRepo) StreamOrders(_ context.Context, filter postgres.OrderFilter, _ int, fn func(page []postgres.StreamedOrder) error) error {
+	r.filter = filter
+	return fn([]postgres.StreamedOrder{{OrderUID: "3", Order: &models.Order{OrderUID: "3"}}})
+}
+
+func TestRestoreCache_DropsDeletedOrders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	saved := storage.NewMemoryStorage()
+	saved.Set("1", &models.Order{OrderUID: "1"})
+	saved.Set("2", &models.Order{OrderUID: "2"})
+	_, err := storage.WriteSnapshot(path, saved, 42)
+	require.NoError(t, err)
+
+	repo := &snapshotRepo{watermark: 50}
+	cache := storage.NewMemoryStorage()
+	require.True(t, restoreCache(context.Background(), zap.NewNop().Sugar(), repo, cache, path,
+		config.WarmUp{PageSize: 10, Workers: 1, Timeout: time.Second}))
+
+	assert.Equal(t, int64(42), repo.since)
+	assert.Equal(t, int64(42), repo.filter.ChangedSince)
+	for uid, want := range map[string]bool{"1": true, "2": false, "3": true} {
+		_, ok := cache.Get(uid)
+		assert.Equal(t, want, ok, uid)
+	}
+
+	// отметка БД меньше отметки снимка — база пересоздана, снимок отбрасывается
+	repo = &snapshotRepo{watermark: 10}
+	cache = storage.NewMemoryStorage()
+	assert.False(t, restoreCache(context.Background(), zap.NewNop().Sugar(), repo, cache, path,
+		config.WarmUp{PageSize: 10, Workers: 1, Timeout: time.Second}))
+	assert.Equal(t, 0, cache.Len())
+}
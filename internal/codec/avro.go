@@ -0,0 +1,107 @@
+package codec
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"sync"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/hamba/avro/v2"
+)
+
+//go:embed order.avsc
+var orderAvsc string
+
+// поля заказа сопоставляются со схемой по json-тегам модели
+var avroAPI = avro.Config{TagKey: "json"}.Freeze()
+
+// avroOrder — заказ для Avro: hamba/avro берёт тег целиком, поэтому поля с опциями
+// json-тега (",omitempty") повторены здесь с чистым именем
+type avroOrder struct {
+	models.Order
+	Status string `json:"status"`
+}
+
+type avroCodec struct {
+	registry *RegistryClient
+	subject  string
+	schema   avro.Schema
+
+	mu      sync.RWMutex
+	writers map[int]avro.Schema
+}
+
+// NewAvro — заказ в Avro по схеме order.avsc; сообщения всегда пишутся в формате Confluent,
+// а при чтении используется схема писателя из реестра
+func NewAvro(registry *RegistryClient, subject string) Codec {
+	return &avroCodec{
+		registry: registry,
+		subject:  subject,
+		schema:   avro.MustParse(orderAvsc),
+		writers:  make(map[int]avro.Schema),
+	}
+}
+
+func (c *avroCodec) Format() string      { return FormatAvro }
+func (c *avroCodec) ContentType() string { return ContentTypeAvro }
+
+func (c *avroCodec) Encode(ctx context.Context, event models.Event) ([]byte, error) {
+	order, err := createdOrder(event)
+	if err != nil {
+		return nil, err
+	}
+	id, err := c.registry.Register(ctx, c.subject, Schema{Type: SchemaTypeAvro, Schema: orderAvsc})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := avroAPI.Marshal(c.schema, avroOrder{Order: *order, Status: order.Status})
+	if err != nil {
+		return nil, fmt.Errorf("encode avro order: %w", err)
+	}
+	return frame(id, payload), nil
+}
+
+func (c *avroCodec) Decode(ctx context.Context, data []byte) (models.Event, error) {
+	id, payload, err := unframe(data)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := c.writerSchema(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var ao avroOrder
+	if err := avroAPI.Unmarshal(schema, payload, &ao); err != nil {
+		return nil, fmt.Errorf("decode avro order: %w", err)
+	}
+	order := ao.Order
+	order.Status = ao.Status
+	return &models.OrderCreated{Order: &order}, nil
+}
+
+// writerSchema — разобранная схема, которой было записано сообщение
+func (c *avroCodec) writerSchema(ctx context.Context, id int) (avro.Schema, error) {
+	c.mu.RLock()
+	schema, ok := c.writers[id]
+	c.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	s, err := c.registry.SchemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.Type != SchemaTypeAvro {
+		return nil, fmt.Errorf("schema %d is %s, not avro", id, s.Type)
+	}
+	schema, err = avro.Parse(s.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("parse schema %d: %w", id, err)
+	}
+	c.mu.Lock()
+	c.writers[id] = schema
+	c.mu.Unlock()
+	return schema, nil
+}
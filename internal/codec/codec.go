@@ -0,0 +1,102 @@
+// Package codec — форматы сообщений с заказами в Kafka: JSON, Protobuf и Avro
+package codec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+)
+
+// заголовок Kafka-сообщения, по которому выбирается формат
+const HeaderContentType = "content-type"
+
+// форматы сообщений
+const (
+	FormatJSON     = "json"
+	FormatProtobuf = "protobuf"
+	FormatAvro     = "avro"
+)
+
+// значения заголовка content-type для форматов
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "application/avro"
+)
+
+// ErrUnsupportedEvent — формат не поддерживает тип события
+var ErrUnsupportedEvent = errors.New("unsupported event type")
+
+// Codec — кодирование события заказа в сообщение Kafka и обратно.
+// JSON передаёт все события жизненного цикла, Protobuf и Avro — только models.OrderCreated
+type Codec interface {
+	Format() string
+	ContentType() string
+	Encode(ctx context.Context, event models.Event) ([]byte, error)
+	Decode(ctx context.Context, data []byte) (models.Event, error)
+}
+
+// createdOrder — заказ из события, которое поддерживают форматы со схемой заказа
+func createdOrder(event models.Event) (*models.Order, error) {
+	created, ok := event.(*models.OrderCreated)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedEvent, event.EventType())
+	}
+	return created.Order, nil
+}
+
+// Set — доступные кодеки и кодек по умолчанию для сообщений без заголовка content-type
+type Set struct {
+	def    Codec
+	byType map[string]Codec
+}
+
+// NewSet создаёт кодеки всех форматов; format — формат по умолчанию и формат продюсера,
+// producer — имя отправителя в обёртке JSON-сообщений.
+// Avro требует реестра схем, Protobuf без реестра пишет сообщения без заголовка Confluent.
+// subject — subject реестра, под которым регистрируются схемы (обычно "<topic>-value")
+func NewSet(format, producer string, registry *RegistryClient, subject string) (*Set, error) {
+	s := &Set{byType: make(map[string]Codec)}
+	codecs := []Codec{NewJSON(producer), NewProtobuf(registry, subject)}
+	if registry != nil {
+		codecs = append(codecs, NewAvro(registry, subject))
+	}
+	for _, c := range codecs {
+		s.byType[c.ContentType()] = c
+		if c.Format() == format {
+			s.def = c
+		}
+	}
+	if s.def == nil {
+		if format == FormatAvro {
+			return nil, fmt.Errorf("format %q requires a schema registry", format)
+		}
+		return nil, fmt.Errorf("unknown message format %q", format)
+	}
+	return s, nil
+}
+
+// Default — кодек формата по умолчанию
+func (s *Set) Default() Codec {
+	return s.def
+}
+
+// ForContentType — кодек для значения заголовка content-type; пустое значение — кодек по умолчанию
+func (s *Set) ForContentType(contentType string) (Codec, error) {
+	if strings.TrimSpace(contentType) == "" {
+		return s.def, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content-type %q: %w", contentType, err)
+	}
+	c, ok := s.byType[mediaType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported content-type %q", contentType)
+	}
+	return c, nil
+}
@@ -0,0 +1,191 @@
+package codec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/codec/orderpb"
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func testOrder() *models.Order {
+	return &models.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction: "b563feb7b2b84b6test", Currency: "USD", Provider: "wbpay", Amount: 1817,
+			PaymentDT: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317, CustomFee: 1,
+		},
+		Items: []models.Items{
+			{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, RID: "ab4219087a764ae0btest", Name: "Mascaras",
+				Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202},
+			{ChrtID: 1, TrackNumber: "WBILMTESTTRACK", Price: -5, RID: "2", Name: "Gift",
+				Sale: 100, Size: "L", TotalPrice: 0, NmID: 3, Brand: "WB", Status: 200},
+		},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		ShardKey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 123456000, time.UTC),
+		OofShard:        "1",
+		Status:          models.StatusPaid,
+	}
+}
+
+func created(o *models.Order) models.Event {
+	return &models.OrderCreated{Order: o}
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	_, srv := newFakeRegistry(t)
+	registry := NewRegistryClient(srv.URL, nil)
+	codecs := []Codec{
+		NewJSON("test"),
+		NewProtobuf(nil, "orders-value"),
+		NewProtobuf(registry, "orders-value"),
+		NewAvro(registry, "orders-value"),
+	}
+	ctx := context.Background()
+	for _, c := range codecs {
+		t.Run(c.Format(), func(t *testing.T) {
+			data, err := c.Encode(ctx, created(testOrder()))
+			require.NoError(t, err)
+			got, err := c.Decode(ctx, data)
+			require.NoError(t, err)
+			assert.Equal(t, created(testOrder()), got)
+		})
+	}
+}
+
+func TestJSON_LifecycleEvents(t *testing.T) {
+	events := []models.Event{
+		&models.OrderPaid{ChangeHeader: models.ChangeHeader{OrderUID: "1", Sequence: 1}, Transaction: "t", PaymentDT: 1637907727},
+		&models.ItemStatusChanged{ChangeHeader: models.ChangeHeader{OrderUID: "1", Sequence: 2}, ChrtID: 9934930, Status: 410},
+		&models.DeliveryUpdated{ChangeHeader: models.ChangeHeader{OrderUID: "1", Sequence: 3}, Delivery: testOrder().Delivery},
+		&models.OrderCancelled{ChangeHeader: models.ChangeHeader{OrderUID: "1", Sequence: 4}, Reason: "customer request"},
+	}
+	c := NewJSON("test")
+	ctx := context.Background()
+	for _, e := range events {
+		data, err := c.Encode(ctx, e)
+		require.NoError(t, err)
+		got, err := c.Decode(ctx, data)
+		require.NoError(t, err)
+		assert.Equal(t, e, got)
+	}
+
+	_, err := c.Decode(ctx, []byte(`{"schema_version":1,"event_type":"order.lost","payload":{}}`))
+	assert.ErrorIs(t, err, ErrUnsupportedEvent)
+	_, err = NewProtobuf(nil, "").Encode(ctx, events[0])
+	assert.ErrorIs(t, err, ErrUnsupportedEvent)
+}
+
+func TestProtobuf_RegistryFraming(t *testing.T) {
+	_, srv := newFakeRegistry(t)
+	c := NewProtobuf(NewRegistryClient(srv.URL, nil), "orders-value")
+	data, err := c.Encode(context.Background(), created(testOrder()))
+	require.NoError(t, err)
+
+	id, rest, err := unframe(data)
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+	assert.Equal(t, byte(0), rest[0], "message indexes [0]")
+
+	// читатель без реестра понимает сообщения в формате Confluent
+	got, err := NewProtobuf(nil, "").Decode(context.Background(), data)
+	require.NoError(t, err)
+	assert.Equal(t, testOrder().OrderUID, got.OrderID())
+}
+
+// сообщения кодека читаются по дескриптору схемы без сгенерированных типов, и наоборот
+func TestProtobuf_Interop(t *testing.T) {
+	fd, err := protodesc.NewFile(protodesc.ToFileDescriptorProto(orderpb.File_order_proto), protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	desc := fd.Messages().ByName("Order")
+	ctx := context.Background()
+
+	data, err := NewProtobuf(nil, "").Encode(ctx, created(testOrder()))
+	require.NoError(t, err)
+	dyn := dynamicpb.NewMessage(desc)
+	require.NoError(t, proto.Unmarshal(data, dyn))
+	assert.Equal(t, testOrder().OrderUID, dyn.Get(desc.Fields().ByName("order_uid")).String())
+	delivery := dyn.Get(desc.Fields().ByName("delivery")).Message()
+	assert.Equal(t, testOrder().Delivery.Phone, delivery.Get(delivery.Descriptor().Fields().ByName("phone")).String())
+	assert.Equal(t, 2, dyn.Get(desc.Fields().ByName("items")).List().Len())
+
+	data, err = proto.Marshal(dyn)
+	require.NoError(t, err)
+	got, err := NewProtobuf(nil, "").Decode(ctx, data)
+	require.NoError(t, err)
+	assert.Equal(t, created(testOrder()), got)
+}
+
+// order.proto, который уходит в реестр, совпадает со схемой сгенерированных типов
+func TestProtobuf_SchemaMatchesGenerated(t *testing.T) {
+	msgs := orderpb.File_order_proto.Messages()
+	for i := 0; i < msgs.Len(); i++ {
+		fields := msgs.Get(i).Fields()
+		for j := 0; j < fields.Len(); j++ {
+			f := fields.Get(j)
+			decl := fmt.Sprintf(" %s = %d;", f.Name(), f.Number())
+			assert.True(t, strings.Contains(orderProto, decl), "%s:%s", msgs.Get(i).Name(), decl)
+		}
+	}
+	assert.Equal(t, protoreflect.Name("Order"), msgs.Get(0).Name(), "message index [0]")
+}
+
+func TestProtobuf_Broken(t *testing.T) {
+	_, err := NewProtobuf(nil, "").Decode(context.Background(), []byte{0x0a, 0x10, 'a'})
+	assert.Error(t, err)
+	// строка вместо вложенного сообщения
+	_, err = NewProtobuf(nil, "").Decode(context.Background(), []byte{0x60, 0x01, 0x22, 0x01, 'x'})
+	assert.Error(t, err)
+}
+
+func TestAvro_UnknownSchema(t *testing.T) {
+	_, srv := newFakeRegistry(t)
+	c := NewAvro(NewRegistryClient(srv.URL, nil), "orders-value")
+	_, err := c.Decode(context.Background(), frame(7, []byte{1}))
+	assert.Error(t, err)
+	_, err = c.Decode(context.Background(), []byte(`{"order_uid":"1"}`))
+	assert.ErrorIs(t, err, errNotFramed)
+}
+
+func TestSet_ForContentType(t *testing.T) {
+	set, err := NewSet(FormatProtobuf, "test", nil, "orders-value")
+	require.NoError(t, err)
+	assert.Equal(t, FormatProtobuf, set.Default().Format())
+
+	c, err := set.ForContentType("")
+	require.NoError(t, err)
+	assert.Equal(t, FormatProtobuf, c.Format())
+	c, err = set.ForContentType("application/json; charset=utf-8")
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSON, c.Format())
+
+	_, err = set.ForContentType(ContentTypeAvro)
+	assert.Error(t, err, "avro is unavailable without a registry")
+	_, err = set.ForContentType("text/plain")
+	assert.Error(t, err)
+
+	_, err = NewSet(FormatAvro, "test", nil, "orders-value")
+	assert.Error(t, err)
+	_, err = NewSet("xml", "test", nil, "orders-value")
+	assert.Error(t, err)
+}
@@ -0,0 +1,51 @@
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/envelope"
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+)
+
+type jsonCodec struct {
+	producer  string
+	upcasters *envelope.Upcasters
+}
+
+// NewJSON — события в JSON в версионированной обёртке envelope.Envelope; producer попадает в обёртку.
+// Сообщения старых версий, в том числе заказы без обёртки, приводятся к текущей версии
+func NewJSON(producer string) Codec {
+	return &jsonCodec{producer: producer, upcasters: envelope.DefaultUpcasters()}
+}
+
+func (c *jsonCodec) Format() string      { return FormatJSON }
+func (c *jsonCodec) ContentType() string { return ContentTypeJSON }
+
+func (c *jsonCodec) Encode(_ context.Context, event models.Event) ([]byte, error) {
+	env, err := envelope.New(event.EventType(), c.producer, event, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(env)
+}
+
+func (c *jsonCodec) Decode(_ context.Context, data []byte) (models.Event, error) {
+	env, err := envelope.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.upcasters.Upcast(env); err != nil {
+		return nil, err
+	}
+	event, ok := models.NewEvent(env.EventType)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedEvent, env.EventType)
+	}
+	if err := json.Unmarshal(env.Payload, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,203 @@
+package codec
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/codec/orderpb"
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// схема сообщений Protobuf для реестра; типы в orderpb сгенерированы по ней (make proto)
+//
+//go:embed order.proto
+var orderProto string
+
+type protobufCodec struct {
+	registry *RegistryClient
+	subject  string
+}
+
+// NewProtobuf — заказ в Protobuf по схеме order.proto. С реестром схема регистрируется в subject,
+// а сообщения пишутся в формате Confluent (magic byte, ID схемы, индексы сообщения)
+func NewProtobuf(registry *RegistryClient, subject string) Codec {
+	return &protobufCodec{registry: registry, subject: subject}
+}
+
+func (c *protobufCodec) Format() string      { return FormatProtobuf }
+func (c *protobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+func (c *protobufCodec) Encode(ctx context.Context, event models.Event) ([]byte, error) {
+	order, err := createdOrder(event)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := marshalOrderProto(order)
+	if err != nil {
+		return nil, err
+	}
+	if c.registry == nil {
+		return payload, nil
+	}
+	id, err := c.registry.Register(ctx, c.subject, Schema{Type: SchemaTypeProtobuf, Schema: orderProto})
+	if err != nil {
+		return nil, err
+	}
+	return append(appendMessageIndexes(frame(id, nil)), payload...), nil
+}
+
+// Decode принимает как сообщения в формате Confluent, так и «голый» Protobuf:
+// корректное сообщение Protobuf не может начинаться с нулевого байта
+func (c *protobufCodec) Decode(ctx context.Context, data []byte) (models.Event, error) {
+	if len(data) > 0 && data[0] == magicByte {
+		id, rest, err := unframe(data)
+		if err != nil {
+			return nil, err
+		}
+		if c.registry != nil {
+			s, err := c.registry.SchemaByID(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if s.Type != SchemaTypeProtobuf {
+				return nil, fmt.Errorf("schema %d is %s, not protobuf", id, s.Type)
+			}
+		}
+		if data, err = consumeMessageIndexes(rest); err != nil {
+			return nil, err
+		}
+	}
+	order, err := unmarshalOrderProto(data)
+	if err != nil {
+		return nil, err
+	}
+	return &models.OrderCreated{Order: order}, nil
+}
+
+func marshalOrderProto(o *models.Order) ([]byte, error) {
+	m := &orderpb.Order{
+		OrderUid:    o.OrderUID,
+		TrackNumber: o.TrackNumber,
+		Entry:       o.Entry,
+		Delivery: &orderpb.Delivery{
+			Name:    o.Delivery.Name,
+			Phone:   o.Delivery.Phone,
+			Zip:     o.Delivery.Zip,
+			City:    o.Delivery.City,
+			Address: o.Delivery.Address,
+			Region:  o.Delivery.Region,
+			Email:   o.Delivery.Email,
+		},
+		Payment: &orderpb.Payment{
+			Transaction:  o.Payment.Transaction,
+			RequestId:    o.Payment.RequestID,
+			Currency:     o.Payment.Currency,
+			Provider:     o.Payment.Provider,
+			Amount:       int64(o.Payment.Amount),
+			PaymentDt:    o.Payment.PaymentDT,
+			Bank:         o.Payment.Bank,
+			DeliveryCost: int64(o.Payment.DeliveryCost),
+			GoodsTotal:   int64(o.Payment.GoodsTotal),
+			CustomFee:    int64(o.Payment.CustomFee),
+		},
+		Items:             make([]*orderpb.Item, 0, len(o.Items)),
+		Locale:            o.Locale,
+		InternalSignature: o.InternalSignature,
+		CustomerId:        o.CustomerID,
+		DeliveryService:   o.DeliveryService,
+		Shardkey:          o.ShardKey,
+		SmId:              int64(o.SmID),
+		OofShard:          o.OofShard,
+		Status:            o.Status,
+	}
+	for _, it := range o.Items {
+		m.Items = append(m.Items, &orderpb.Item{
+			ChrtId:      int64(it.ChrtID),
+			TrackNumber: it.TrackNumber,
+			Price:       int64(it.Price),
+			Rid:         it.RID,
+			Name:        it.Name,
+			Sale:        int64(it.Sale),
+			Size:        it.Size,
+			TotalPrice:  int64(it.TotalPrice),
+			NmId:        int64(it.NmID),
+			Brand:       it.Brand,
+			Status:      int64(it.Status),
+		})
+	}
+	if !o.DateCreated.IsZero() {
+		m.DateCreated = timestamppb.New(o.DateCreated)
+	}
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("encode protobuf order: %w", err)
+	}
+	return data, nil
+}
+
+func unmarshalOrderProto(data []byte) (*models.Order, error) {
+	var m orderpb.Order
+	if err := proto.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decode protobuf order: %w", err)
+	}
+	d, p := m.GetDelivery(), m.GetPayment()
+	o := &models.Order{
+		OrderUID:    m.GetOrderUid(),
+		TrackNumber: m.GetTrackNumber(),
+		Entry:       m.GetEntry(),
+		Delivery: models.Delivery{
+			Name:    d.GetName(),
+			Phone:   d.GetPhone(),
+			Zip:     d.GetZip(),
+			City:    d.GetCity(),
+			Address: d.GetAddress(),
+			Region:  d.GetRegion(),
+			Email:   d.GetEmail(),
+		},
+		Payment: models.Payment{
+			Transaction:  p.GetTransaction(),
+			RequestID:    p.GetRequestId(),
+			Currency:     p.GetCurrency(),
+			Provider:     p.GetProvider(),
+			Amount:       int(p.GetAmount()),
+			PaymentDT:    p.GetPaymentDt(),
+			Bank:         p.GetBank(),
+			DeliveryCost: int(p.GetDeliveryCost()),
+			GoodsTotal:   int(p.GetGoodsTotal()),
+			CustomFee:    int(p.GetCustomFee()),
+		},
+		Locale:            m.GetLocale(),
+		InternalSignature: m.GetInternalSignature(),
+		CustomerID:        m.GetCustomerId(),
+		DeliveryService:   m.GetDeliveryService(),
+		ShardKey:          m.GetShardkey(),
+		SmID:              int(m.GetSmId()),
+		OofShard:          m.GetOofShard(),
+		Status:            m.GetStatus(),
+	}
+	for _, it := range m.GetItems() {
+		o.Items = append(o.Items, models.Items{
+			ChrtID:      int(it.GetChrtId()),
+			TrackNumber: it.GetTrackNumber(),
+			Price:       int(it.GetPrice()),
+			RID:         it.GetRid(),
+			Name:        it.GetName(),
+			Sale:        int(it.GetSale()),
+			Size:        it.GetSize(),
+			TotalPrice:  int(it.GetTotalPrice()),
+			NmID:        int(it.GetNmId()),
+			Brand:       it.GetBrand(),
+			Status:      int(it.GetStatus()),
+		})
+	}
+	if ts := m.GetDateCreated(); ts != nil {
+		if err := ts.CheckValid(); err != nil {
+			return nil, fmt.Errorf("decode protobuf order: %w", err)
+		}
+		o.DateCreated = ts.AsTime()
+	}
+	return o, nil
+}
@@ -0,0 +1,128 @@
+package codec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// типы схем в реестре; пустой тип реестр трактует как AVRO
+const (
+	SchemaTypeAvro     = "AVRO"
+	SchemaTypeProtobuf = "PROTOBUF"
+)
+
+const registryContentType = "application/vnd.schemaregistry.v1+json"
+
+// Schema — схема в реестре
+type Schema struct {
+	Type   string `json:"schemaType,omitempty"`
+	Schema string `json:"schema"`
+}
+
+// RegistryClient — клиент Confluent-совместимого реестра схем.
+// Схемы по ID и ID зарегистрированных схем кэшируются: в реестре они не меняются
+type RegistryClient struct {
+	baseURL string
+	http    *http.Client
+
+	mu   sync.RWMutex
+	byID map[int]Schema
+	ids  map[string]int
+}
+
+// конструктор RegistryClient; httpClient == nil — клиент с тайм-аутом 5 секунд
+func NewRegistryClient(baseURL string, httpClient *http.Client) *RegistryClient {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &RegistryClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    httpClient,
+		byID:    make(map[int]Schema),
+		ids:     make(map[string]int),
+	}
+}
+
+// Register регистрирует схему в subject (или находит уже зарегистрированную) и возвращает её ID
+func (c *RegistryClient) Register(ctx context.Context, subject string, s Schema) (int, error) {
+	key := subject + "\x00" + s.Type + "\x00" + s.Schema
+	c.mu.RLock()
+	id, ok := c.ids[key]
+	c.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	var resp struct {
+		ID int `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/subjects/"+subject+"/versions", s, &resp); err != nil {
+		return 0, fmt.Errorf("register schema for %s: %w", subject, err)
+	}
+	c.mu.Lock()
+	c.ids[key] = resp.ID
+	c.byID[resp.ID] = s
+	c.mu.Unlock()
+	return resp.ID, nil
+}
+
+// SchemaByID возвращает схему по её ID
+func (c *RegistryClient) SchemaByID(ctx context.Context, id int) (Schema, error) {
+	c.mu.RLock()
+	s, ok := c.byID[id]
+	c.mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &s); err != nil {
+		return Schema{}, fmt.Errorf("get schema %d: %w", id, err)
+	}
+	if s.Type == "" {
+		s.Type = SchemaTypeAvro
+	}
+	c.mu.Lock()
+	c.byID[id] = s
+	c.mu.Unlock()
+	return s, nil
+}
+
+func (c *RegistryClient) do(ctx context.Context, method, path string, body, out any) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", registryContentType)
+	if body != nil {
+		req.Header.Set("Content-Type", registryContentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var regErr struct {
+			Code    int    `json:"error_code"`
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&regErr) == nil && regErr.Message != "" {
+			return fmt.Errorf("schema registry: %s (%d)", regErr.Message, regErr.Code)
+		}
+		return fmt.Errorf("schema registry: unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,100 @@
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistry — реестр схем в памяти с тем же HTTP API, что у Confluent Schema Registry
+type fakeRegistry struct {
+	mu       sync.Mutex
+	schemas  []Schema
+	requests atomic.Int32
+}
+
+func newFakeRegistry(t *testing.T) (*fakeRegistry, *httptest.Server) {
+	r := &fakeRegistry{}
+	srv := httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.requests.Add(1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w.Header().Set("Content-Type", registryContentType)
+	switch {
+	case req.Method == http.MethodPost && strings.HasPrefix(req.URL.Path, "/subjects/"):
+		var s Schema
+		if err := json.NewDecoder(req.Body).Decode(&s); err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprintf(w, `{"error_code":42201,"message":"invalid schema"}`)
+			return
+		}
+		if s.Type == "" {
+			s.Type = SchemaTypeAvro
+		}
+		id := len(r.schemas) + 1
+		for i, known := range r.schemas {
+			if known == s {
+				id = i + 1
+			}
+		}
+		if id > len(r.schemas) {
+			r.schemas = append(r.schemas, s)
+		}
+		fmt.Fprintf(w, `{"id":%d}`, id)
+	case req.Method == http.MethodGet && strings.HasPrefix(req.URL.Path, "/schemas/ids/"):
+		id, _ := strconv.Atoi(strings.TrimPrefix(req.URL.Path, "/schemas/ids/"))
+		if id < 1 || id > len(r.schemas) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error_code":40403,"message":"Schema not found"}`)
+			return
+		}
+		s := r.schemas[id-1]
+		if s.Type == SchemaTypeAvro {
+			// реестр не возвращает schemaType для Avro
+			s.Type = ""
+		}
+		_ = json.NewEncoder(w).Encode(s)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRegistryClient_RegisterAndFetch(t *testing.T) {
+	reg, srv := newFakeRegistry(t)
+	client := NewRegistryClient(srv.URL+"/", nil)
+	ctx := context.Background()
+
+	id, err := client.Register(ctx, "orders-value", Schema{Type: SchemaTypeAvro, Schema: `"string"`})
+	require.NoError(t, err)
+	again, err := client.Register(ctx, "orders-value", Schema{Type: SchemaTypeAvro, Schema: `"string"`})
+	require.NoError(t, err)
+	assert.Equal(t, id, again)
+	assert.Equal(t, int32(1), reg.requests.Load())
+
+	// новый клиент не знает схему и запрашивает её; тип Avro подставляется по умолчанию
+	s, err := NewRegistryClient(srv.URL, nil).SchemaByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, Schema{Type: SchemaTypeAvro, Schema: `"string"`}, s)
+}
+
+func TestRegistryClient_Error(t *testing.T) {
+	_, srv := newFakeRegistry(t)
+	_, err := NewRegistryClient(srv.URL, nil).SchemaByID(context.Background(), 42)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Schema not found")
+}
@@ -0,0 +1,56 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// формат Confluent: нулевой байт, ID схемы (4 байта, big-endian), затем полезная нагрузка
+const magicByte = 0
+
+var errNotFramed = errors.New("message is not in schema registry wire format")
+
+func frame(id int, payload []byte) []byte {
+	out := make([]byte, 5, 5+len(payload))
+	out[0] = magicByte
+	binary.BigEndian.PutUint32(out[1:], uint32(id))
+	return append(out, payload...)
+}
+
+func unframe(data []byte) (int, []byte, error) {
+	if len(data) < 5 || data[0] != magicByte {
+		return 0, nil, errNotFramed
+	}
+	return int(binary.BigEndian.Uint32(data[1:5])), data[5:], nil
+}
+
+// для Protobuf после ID идут индексы сообщения в файле схемы; [0] — первое сообщение, кодируется одним нулём
+func appendMessageIndexes(b []byte) []byte {
+	return append(b, 0)
+}
+
+// consumeMessageIndexes проверяет, что сообщение — первое в схеме, и возвращает остаток данных
+func consumeMessageIndexes(data []byte) ([]byte, error) {
+	count, n := protowire.ConsumeVarint(data)
+	if n < 0 {
+		return nil, fmt.Errorf("read message indexes: %w", protowire.ParseError(n))
+	}
+	data = data[n:]
+	if count == 0 {
+		return data, nil
+	}
+	for i := 0; i < int(protowire.DecodeZigZag(count)); i++ {
+		idx, n := protowire.ConsumeVarint(data)
+		if n < 0 {
+			return nil, fmt.Errorf("read message indexes: %w", protowire.ParseError(n))
+		}
+		if idx != 0 {
+			return nil, fmt.Errorf("unsupported protobuf message index %d", protowire.DecodeZigZag(idx))
+		}
+		data = data[n:]
+	}
+	return data, nil
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
@@ -11,10 +12,26 @@ type Config struct {
 	Server   `yaml:"server"`
 	Postgres `yaml:"postgres"`
 	Kafka    `yaml:"kafka"`
+	Cache    `yaml:"cache"`
+	Redis    `yaml:"redis"`
+	// реестр схем для Protobuf и Avro
+	SchemaRegistry `yaml:"schema_registry"`
+	Outbox         `yaml:"outbox"`
+	Tracing        `yaml:"tracing"`
+	Log            `yaml:"log"`
 }
 
 type Server struct {
 	Port int `yaml:"port" env:"SERVER_PORT"`
+	// сколько помнить, что заказа нет в БД (0 — не запоминать)
+	NotFoundTTL time.Duration `yaml:"not_found_ttl" env:"SERVER_NOT_FOUND_TTL" env-default:"5s"`
+	// токен для /admin/*; пустой токен отключает admin API
+	AdminToken string `yaml:"admin_token" env:"SERVER_ADMIN_TOKEN"`
+	// роль вызывающего определяет маскирование персональных данных в ответах API:
+	// full — без маскирования, support — частичное (+7******1234), public — полное.
+	// Роль берётся по токену из role_tokens (токен → роль), токен администратора даёт full
+	DefaultRole string            `yaml:"default_role" env:"SERVER_DEFAULT_ROLE" env-default:"public"`
+	RoleTokens  map[string]string `yaml:"role_tokens" env:"SERVER_ROLE_TOKENS"`
 }
 
 type Postgres struct {
@@ -23,12 +40,118 @@ type Postgres struct {
 	User     string `yaml:"user" env:"POSTGRES_USER"`
 	Password string `yaml:"password" env:"POSTGRES_PASSWORD"`
 	DBName   string `yaml:"dbname" env:"POSTGRES_DB"`
+	// что делать с изменённым заказом, order_uid которого уже сохранён: reject, overwrite или version
+	OnConflict string `yaml:"on_conflict" env:"POSTGRES_ON_CONFLICT" env-default:"reject"`
 }
 
 type Kafka struct {
 	Broker  string `yaml:"broker" env:"KAFKA_BROKER"`
 	Topic   string `yaml:"topic" env:"KAFKA_TOPIC"`
 	GroupID string `yaml:"group_id" env:"KAFKA_GROUP_ID"`
+	// топик для сообщений, которые не удалось разобрать или сохранить (пусто — отключено)
+	DLQTopic string `yaml:"dlq_topic" env:"KAFKA_DLQ_TOPIC"`
+	// формат сообщений продюсера и сообщений без заголовка content-type: json, protobuf или avro
+	Format string `yaml:"format" env:"KAFKA_FORMAT" env-default:"json"`
+	// имя отправителя в обёртке JSON-сообщений продюсера
+	Producer string `yaml:"producer" env:"KAFKA_PRODUCER" env-default:"order-service"`
+	// число параллельных обработчиков сообщений
+	Workers int `yaml:"workers" env:"KAFKA_WORKERS" env-default:"4"`
+	// порядок обработки: partition — по партициям, key — по ключу сообщения (order_uid)
+	Ordering string `yaml:"ordering" env:"KAFKA_ORDERING" env-default:"partition"`
+	// заказы сохраняются пакетами до batch_size штук; неполный пакет сохраняется через batch_window
+	BatchSize   int           `yaml:"batch_size" env:"KAFKA_BATCH_SIZE" env-default:"100"`
+	BatchWindow time.Duration `yaml:"batch_window" env:"KAFKA_BATCH_WINDOW" env-default:"100ms"`
+	// повторы сохранения заказа при временных ошибках БД
+	Retry Retry `yaml:"retry"`
+}
+
+// политика повторов: экспоненциальная пауза от base_delay до max_delay со случайным разбросом jitter (0..1)
+type Retry struct {
+	MaxAttempts int           `yaml:"max_attempts" env:"KAFKA_RETRY_MAX_ATTEMPTS" env-default:"5"`
+	BaseDelay   time.Duration `yaml:"base_delay" env:"KAFKA_RETRY_BASE_DELAY" env-default:"200ms"`
+	MaxDelay    time.Duration `yaml:"max_delay" env:"KAFKA_RETRY_MAX_DELAY" env-default:"5s"`
+	Jitter      float64       `yaml:"jitter" env:"KAFKA_RETRY_JITTER" env-default:"0.5"`
+}
+
+// настройки кэша заказов; нулевые лимиты и TTL означают отсутствие ограничения
+type Cache struct {
+	// memory — кэш в памяти реплики, redis — общий кэш, tiered — память перед Redis
+	Backend         string        `yaml:"backend" env:"CACHE_BACKEND" env-default:"memory"`
+	MaxEntries      int           `yaml:"max_entries" env:"CACHE_MAX_ENTRIES"`
+	MaxBytes        int64         `yaml:"max_bytes" env:"CACHE_MAX_BYTES"`
+	Policy          string        `yaml:"policy" env:"CACHE_POLICY" env-default:"lru"`
+	Shards          int           `yaml:"shards" env:"CACHE_SHARDS"`
+	TTL             time.Duration `yaml:"ttl" env:"CACHE_TTL"`
+	JanitorInterval time.Duration `yaml:"janitor_interval" env:"CACHE_JANITOR_INTERVAL" env-default:"1m"`
+	RefreshAhead    time.Duration `yaml:"refresh_ahead" env:"CACHE_REFRESH_AHEAD"`
+	// срок жизни локальных копий в режиме tiered (0 — как у ttl)
+	LocalTTL time.Duration `yaml:"local_ttl" env:"CACHE_LOCAL_TTL"`
+	// файл снимка кэша для быстрого перезапуска (пусто — снимки отключены)
+	SnapshotPath string `yaml:"snapshot_path" env:"CACHE_SNAPSHOT_PATH"`
+	// реакция на изменения заказов в БД (LISTEN/NOTIFY): off, invalidate или refresh
+	DBChanges string `yaml:"db_changes" env:"CACHE_DB_CHANGES" env-default:"invalidate"`
+	WarmUp    WarmUp `yaml:"warm_up"`
+}
+
+// прогрев кэша при старте; нулевые Days и Limit означают загрузку всех заказов
+type WarmUp struct {
+	Days     int           `yaml:"days" env:"CACHE_WARMUP_DAYS"`
+	Limit    int           `yaml:"limit" env:"CACHE_WARMUP_LIMIT"`
+	PageSize int           `yaml:"page_size" env:"CACHE_WARMUP_PAGE_SIZE" env-default:"500"`
+	Workers  int           `yaml:"workers" env:"CACHE_WARMUP_WORKERS" env-default:"4"`
+	Timeout  time.Duration `yaml:"timeout" env:"CACHE_WARMUP_TIMEOUT" env-default:"2m"`
+}
+
+type Redis struct {
+	Addr      string `yaml:"addr" env:"REDIS_ADDR"`
+	Password  string `yaml:"password" env:"REDIS_PASSWORD"`
+	DB        int    `yaml:"db" env:"REDIS_DB"`
+	KeyPrefix string `yaml:"key_prefix" env:"REDIS_KEY_PREFIX" env-default:"orders:"`
+}
+
+// реестр схем (Confluent Schema Registry API); пустой url — без реестра, Avro недоступен
+type SchemaRegistry struct {
+	URL string `yaml:"url" env:"SCHEMA_REGISTRY_URL"`
+	// subject для схемы заказа (пусто — "<kafka.topic>-value")
+	Subject string        `yaml:"subject" env:"SCHEMA_REGISTRY_SUBJECT"`
+	Timeout time.Duration `yaml:"timeout" env:"SCHEMA_REGISTRY_TIMEOUT" env-default:"5s"`
+}
+
+// отправка событий о сохранённых заказах из таблицы outbox в Kafka
+type Outbox struct {
+	// топик для событий; пустой топик отключает отправку (события копятся в таблице)
+	Topic     string        `yaml:"topic" env:"OUTBOX_TOPIC" env-default:"orders.persisted"`
+	Interval  time.Duration `yaml:"interval" env:"OUTBOX_INTERVAL" env-default:"1s"`
+	BatchSize int           `yaml:"batch_size" env:"OUTBOX_BATCH_SIZE" env-default:"100"`
+	// сколько хранить отправленные события; 0 — удалять сразу после отправки
+	Retention time.Duration `yaml:"retention" env:"OUTBOX_RETENTION" env-default:"24h"`
+}
+
+// экспорт трассировок по OTLP/HTTP; пустой endpoint отключает экспорт,
+// но контекст трассировки по-прежнему передаётся дальше
+type Tracing struct {
+	// адрес коллектора host:port (например, jaeger:4318)
+	Endpoint    string `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+	Insecure    bool   `yaml:"insecure" env:"TRACING_INSECURE" env-default:"true"`
+	ServiceName string `yaml:"service_name" env:"TRACING_SERVICE_NAME" env-default:"order-service"`
+	// доля трассировок, начатых сервисом, которые записываются (0..1)
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" env-default:"1"`
+}
+
+// настройки логирования; уровень можно поменять во время работы через /admin/log/level
+type Log struct {
+	// debug, info, warn, error
+	Level string `yaml:"level" env:"LOG_LEVEL" env-default:"info"`
+	// json или console
+	Encoding string      `yaml:"encoding" env:"LOG_ENCODING" env-default:"json"`
+	Sampling LogSampling `yaml:"sampling"`
+}
+
+// выборка повторяющихся записей: за секунду пишутся первые initial одинаковых записей,
+// затем каждая thereafter-я; initial 0 отключает выборку
+type LogSampling struct {
+	Initial    int `yaml:"initial" env:"LOG_SAMPLING_INITIAL" env-default:"100"`
+	Thereafter int `yaml:"thereafter" env:"LOG_SAMPLING_THEREAFTER" env-default:"100"`
 }
 
 func NewConfig() (*Config, error) {
@@ -0,0 +1,129 @@
+// Package envelope — версионированная обёртка JSON-сообщений с заказами и приведение старых версий к текущей
+package envelope
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+)
+
+// версии содержимого сообщения
+const (
+	// сообщение без обёртки — заказ целиком, как его публиковали до появления версий
+	LegacyVersion = 0
+	// текущая версия: payload совпадает с models.Order
+	CurrentVersion = 1
+)
+
+var ErrUnsupportedVersion = errors.New("unsupported schema version")
+
+// Envelope — обёртка сообщения: версия и тип содержимого, кто и когда его отправил
+type Envelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	EventType     string          `json:"event_type"`
+	Producer      string          `json:"producer"`
+	ProducedAt    time.Time       `json:"produced_at"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// New оборачивает payload текущей версии
+func New(eventType, producer string, payload any, now time.Time) (*Envelope, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		SchemaVersion: CurrentVersion,
+		EventType:     eventType,
+		Producer:      producer,
+		ProducedAt:    now.UTC(),
+		Payload:       data,
+	}, nil
+}
+
+// Parse разбирает сообщение; JSON без schema_version считается заказом версии LegacyVersion
+func Parse(data []byte) (*Envelope, error) {
+	var probe struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+	if probe.SchemaVersion == nil {
+		return &Envelope{
+			SchemaVersion: LegacyVersion,
+			EventType:     models.EventOrderCreated,
+			Payload:       bytes.Clone(data),
+		}, nil
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	if env.EventType == "" {
+		return nil, errors.New("envelope has no event_type")
+	}
+	if len(env.Payload) == 0 || string(env.Payload) == "null" {
+		return nil, errors.New("envelope has no payload")
+	}
+	return &env, nil
+}
+
+// Upcaster переводит payload из версии from в версию from+1
+type Upcaster func(eventType string, payload json.RawMessage) (json.RawMessage, error)
+
+// Upcasters — цепочка преобразований старых версий payload в текущую
+type Upcasters struct {
+	current int
+	steps   map[int]Upcaster
+}
+
+// NewUpcasters — пустой реестр для версии current
+func NewUpcasters(current int) *Upcasters {
+	return &Upcasters{current: current, steps: make(map[int]Upcaster)}
+}
+
+// DefaultUpcasters — реестр для всех поддерживаемых версий сообщений
+func DefaultUpcasters() *Upcasters {
+	u := NewUpcasters(CurrentVersion)
+	// заказ без обёртки — тот же payload, что и в версии 1
+	u.Register(LegacyVersion, func(_ string, payload json.RawMessage) (json.RawMessage, error) {
+		return payload, nil
+	})
+	return u
+}
+
+// Register задаёт преобразование из версии from в from+1
+func (u *Upcasters) Register(from int, fn Upcaster) {
+	u.steps[from] = fn
+}
+
+// Current — версия, к которой приводятся сообщения
+func (u *Upcasters) Current() int {
+	return u.current
+}
+
+// Upcast приводит payload обёртки к текущей версии
+func (u *Upcasters) Upcast(env *Envelope) error {
+	if env.SchemaVersion > u.current {
+		return fmt.Errorf("%w %d: newest known is %d", ErrUnsupportedVersion, env.SchemaVersion, u.current)
+	}
+	for env.SchemaVersion < u.current {
+		step, ok := u.steps[env.SchemaVersion]
+		if !ok {
+			return fmt.Errorf("%w %d", ErrUnsupportedVersion, env.SchemaVersion)
+		}
+		payload, err := step(env.EventType, env.Payload)
+		if err != nil {
+			return fmt.Errorf("upcast from version %d: %w", env.SchemaVersion, err)
+		}
+		env.Payload = payload
+		env.SchemaVersion++
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package envelope
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// go test ./internal/envelope -update перезаписывает эталон
+var update = flag.Bool("update", false, "update golden files")
+
+// testdata/vN_*.json — сообщения каждой поддерживаемой версии; все они должны давать один и тот же заказ
+func TestUpcast_Golden(t *testing.T) {
+	golden := filepath.Join("testdata", "order.golden.json")
+	for v := LegacyVersion; v <= CurrentVersion; v++ {
+		files, err := filepath.Glob(filepath.Join("testdata", fmt.Sprintf("v%d_*.json", v)))
+		require.NoError(t, err)
+		require.NotEmpty(t, files, "no golden input for schema version %d", v)
+
+		for _, file := range files {
+			t.Run(filepath.Base(file), func(t *testing.T) {
+				data, err := os.ReadFile(file)
+				require.NoError(t, err)
+				env, err := Parse(data)
+				require.NoError(t, err)
+				assert.Equal(t, v, env.SchemaVersion)
+				require.NoError(t, DefaultUpcasters().Upcast(env))
+				assert.Equal(t, CurrentVersion, env.SchemaVersion)
+
+				var order models.Order
+				require.NoError(t, json.Unmarshal(env.Payload, &order))
+				got, err := json.MarshalIndent(order, "", "  ")
+				require.NoError(t, err)
+				got = append(got, '\n')
+
+				if *update {
+					require.NoError(t, os.WriteFile(golden, got, 0o644))
+				}
+				want, err := os.ReadFile(golden)
+				require.NoError(t, err)
+				assert.JSONEq(t, string(want), string(got))
+			})
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	env, err := Parse([]byte(`{"order_uid":"1"}`))
+	require.NoError(t, err)
+	assert.Equal(t, LegacyVersion, env.SchemaVersion)
+	assert.Equal(t, models.EventOrderCreated, env.EventType)
+	assert.JSONEq(t, `{"order_uid":"1"}`, string(env.Payload))
+
+	_, err = Parse([]byte(`{"schema_version":1,"payload":{}}`))
+	assert.Error(t, err, "no event type")
+	_, err = Parse([]byte(`{"schema_version":1,"event_type":"order.created"}`))
+	assert.Error(t, err, "no payload")
+	_, err = Parse([]byte(`{not json`))
+	assert.Error(t, err)
+}
+
+func TestNew_RoundTrip(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("MSK", 3*3600))
+	env, err := New(models.EventOrderCreated, "test", &models.Order{OrderUID: "1"}, now)
+	require.NoError(t, err)
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+
+	parsed, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, CurrentVersion, parsed.SchemaVersion)
+	assert.Equal(t, "test", parsed.Producer)
+	assert.True(t, parsed.ProducedAt.Equal(now))
+	assert.Equal(t, time.UTC, parsed.ProducedAt.Location())
+}
+
+func TestUpcasters_Chain(t *testing.T) {
+	u := NewUpcasters(2)
+	u.Register(0, func(_ string, p json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(`{"step":1}`), nil
+	})
+	u.Register(1, func(eventType string, p json.RawMessage) (json.RawMessage, error) {
+		assert.JSONEq(t, `{"step":1}`, string(p))
+		return json.RawMessage(`{"step":2,"event":"` + eventType + `"}`), nil
+	})
+
+	env := &Envelope{SchemaVersion: 0, EventType: models.EventOrderCreated, Payload: json.RawMessage(`{}`)}
+	require.NoError(t, u.Upcast(env))
+	assert.Equal(t, 2, env.SchemaVersion)
+	assert.JSONEq(t, `{"step":2,"event":"order.created"}`, string(env.Payload))
+}
+
+func TestUpcasters_UnsupportedVersion(t *testing.T) {
+	u := DefaultUpcasters()
+	err := u.Upcast(&Envelope{SchemaVersion: CurrentVersion + 1})
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+	err = u.Upcast(&Envelope{SchemaVersion: -1})
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	// пропущенный шаг цепочки
+	gap := NewUpcasters(2)
+	gap.Register(0, func(_ string, p json.RawMessage) (json.RawMessage, error) { return p, nil })
+	err = gap.Upcast(&Envelope{SchemaVersion: 0, Payload: json.RawMessage(`{}`)})
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+}
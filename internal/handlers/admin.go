@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/storage"
+	"github.com/MikhaylovMaks/wb_techl0/pkg/logger"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap/zapcore"
+)
+
+// статистика кэша
+func (s *Server) CacheStats(w http.ResponseWriter, r *http.Request) {
+	sp, ok := s.cache.(storage.StatsProvider)
+	if !ok {
+		http.Error(w, "cache statistics are not available", http.StatusNotImplemented)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(sp.Stats()); err != nil {
+		s.log.Errorw("failed to encode cache stats", "err", err)
+	}
+}
+
+// удаление заказа из кэша
+func (s *Server) InvalidateCachedOrder(w http.ResponseWriter, r *http.Request) {
+	orderUID := mux.Vars(r)["order_uid"]
+	s.cache.Invalidate(orderUID)
+	s.notFound.Remove(orderUID)
+	logger.FromContext(r.Context(), s.log).Infow("order invalidated via admin api", "order_uid", orderUID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// полная очистка кэша
+func (s *Server) InvalidateCache(w http.ResponseWriter, r *http.Request) {
+	s.cache.InvalidateAll()
+	logger.FromContext(r.Context(), s.log).Info("cache invalidated via admin api")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// проверка токена администратора; без настроенного токена доступ закрыт
+func (s *Server) withAdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get("Authorization")
+		want := "Bearer " + s.adminToken
+		if s.adminToken == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// текущий уровень логирования
+func (s *Server) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(logLevel{Level: s.logLevel.String()}); err != nil {
+		s.log.Errorw("failed to encode log level", "err", err)
+	}
+}
+
+// смена уровня логирования без перезапуска: PUT {"level":"debug"}
+func (s *Server) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req logLevel
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	level, err := zapcore.ParseLevel(req.Level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prev := s.logLevel.Level()
+	s.logLevel.SetLevel(level)
+	logger.FromContext(r.Context(), s.log).Warnw("log level changed via admin api", "from", prev, "to", level)
+	s.GetLogLevel(w, r)
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
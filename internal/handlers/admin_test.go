@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestCacheStats(t *testing.T) {
+	cache := storage.NewInstrumentedCache(storage.NewMemoryStorage())
+	cache.Set("abc", &models.Order{OrderUID: "abc"})
+	repo := new(mockRepo)
+	repo.On("GetOrderByUID", mock.Anything, "xyz").Return(&models.Order{OrderUID: "xyz"}, nil)
+
+	router := newTestServer(repo, cache).Router()
+	for _, uid := range []string{"abc", "abc", "xyz"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/"+uid, nil))
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodGet, "/admin/cache/stats", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var stats storage.Stats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, uint64(1), stats.Loads)
+	assert.Equal(t, 2, stats.Entries)
+}
+
+func TestInvalidateCachedOrder(t *testing.T) {
+	cache := storage.NewMemoryStorage()
+	cache.Set("abc", &models.Order{OrderUID: "abc"})
+	cache.Set("def", &models.Order{OrderUID: "def"})
+	router := newTestServer(new(mockRepo), cache).Router()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodDelete, "/admin/cache/abc", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	_, ok := cache.Get("abc")
+	assert.False(t, ok)
+	_, ok = cache.Get("def")
+	assert.True(t, ok)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodDelete, "/admin/cache", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	_, ok = cache.Get("def")
+	assert.False(t, ok)
+}
+
+func TestAdminAuth(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	server := NewServer(config.Server{AdminToken: "secret"}, new(mockRepo), storage.NewMemoryStorage(), nil, zap.NewAtomicLevel(), logger.Sugar())
+	router := server.Router()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/admin/cache", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/cache", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestAdminDisabledWithoutToken(t *testing.T) {
+	cache := storage.NewMemoryStorage()
+	cache.Set("abc", &models.Order{OrderUID: "abc"})
+	server := NewServer(config.Server{}, new(mockRepo), cache, nil, zap.NewAtomicLevel(), zap.NewNop().Sugar())
+	router := server.Router()
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/admin/cache/stats", nil),
+		httptest.NewRequest(http.MethodDelete, "/admin/cache", nil),
+		httptest.NewRequest(http.MethodDelete, "/admin/cache/abc", nil),
+	} {
+		// пустой токен не должен совпасть с ненастроенным
+		req.Header.Set("Authorization", "Bearer ")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code, "%s %s", req.Method, req.URL.Path)
+	}
+	_, ok := cache.Get("abc")
+	assert.True(t, ok)
+}
+
+func TestLogLevel(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	server := NewServer(config.Server{AdminToken: testAdminToken}, new(mockRepo), storage.NewMemoryStorage(), nil, level, zap.NewNop().Sugar())
+	router := server.Router()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodGet, "/admin/log/level", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"level":"info"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodPut, "/admin/log/level", strings.NewReader(`{"level":"debug"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"level":"debug"}`, w.Body.String())
+	assert.Equal(t, zapcore.DebugLevel, level.Level())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodPut, "/admin/log/level", strings.NewReader(`{"level":"loud"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, zapcore.DebugLevel, level.Level())
+}
+
+func TestLogLevel_RequiresAdminToken(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	for _, token := range []string{"", testAdminToken} {
+		server := NewServer(config.Server{AdminToken: token}, new(mockRepo), storage.NewMemoryStorage(), nil, level, zap.NewNop().Sugar())
+		w := httptest.NewRecorder()
+		// запрос без токена
+		server.Router().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/log/level", strings.NewReader(`{"level":"debug"}`)))
+		assert.Contains(t, []int{http.StatusUnauthorized, http.StatusNotFound}, w.Code, "admin token %q", token)
+	}
+	assert.Equal(t, zapcore.InfoLevel, level.Level())
+}
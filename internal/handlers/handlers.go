@@ -8,28 +8,68 @@ import (
 	"net/http"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/pii"
 	"github.com/MikhaylovMaks/wb_techl0/internal/repository/postgres"
 	"github.com/MikhaylovMaks/wb_techl0/internal/storage"
+	"github.com/MikhaylovMaks/wb_techl0/pkg/logger"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
+// максимальное время загрузки заказа из БД при промахе кэша
+const loadTimeout = 5 * time.Second
+
 type Server struct {
-	port  int
-	repo  postgres.OrderRepository
-	cache storage.Cache
-	log   *zap.SugaredLogger
-	srv   *http.Server
+	port        int
+	adminToken  string
+	defaultRole Role
+	roleTokens  map[string]Role
+	repo        postgres.OrderRepository
+	cache       storage.Cache
+	notFound    *storage.NegativeCache
+	loads       singleflight.Group
+	metrics     *prometheus.Registry // nil — метрики отключены, /metrics не регистрируется
+	httpMetrics *httpMetrics
+	logLevel    zap.AtomicLevel
+	log         *zap.SugaredLogger
+	srv         *http.Server
 }
 
-func NewServer(port int, repo postgres.OrderRepository, cache storage.Cache, log *zap.SugaredLogger) *Server {
-	return &Server{
-		port:  port,
-		repo:  repo,
-		cache: cache,
-		log:   log}
+// конструктор Server; logLevel — уровень логгера log, который меняется через /admin/log/level.
+// Роли из cfg должны быть проверены CheckRoles
+func NewServer(cfg config.Server, repo postgres.OrderRepository, cache storage.Cache, metrics *prometheus.Registry, logLevel zap.AtomicLevel, log *zap.SugaredLogger) *Server {
+	s := &Server{
+		port:       cfg.Port,
+		adminToken: cfg.AdminToken,
+		repo:       repo,
+		cache:      cache,
+		notFound:   storage.NewNegativeCache(cfg.NotFoundTTL),
+		metrics:    metrics,
+		logLevel:   logLevel,
+		log:        log}
+	// без настройки роли персональные данные скрыты; full открывают только токены
+	s.defaultRole = RolePublic
+	if cfg.DefaultRole != "" {
+		s.defaultRole = Role(cfg.DefaultRole)
+	}
+	s.roleTokens = make(map[string]Role, len(cfg.RoleTokens))
+	for token, role := range cfg.RoleTokens {
+		s.roleTokens[token] = Role(role)
+	}
+	if metrics != nil {
+		s.httpMetrics = newHTTPMetrics(metrics)
+	}
+	return s
 }
 
 // Создаёт маршрутизатор и регистрирует маршруты и middlewares
@@ -37,7 +77,9 @@ func (s *Server) Router() http.Handler {
 	r := mux.NewRouter()
 
 	// middlewares
-	r.Use(withRequestID)
+	r.Use(s.withRequestID)
+	r.Use(withTracing)
+	r.Use(s.withMetrics)
 	r.Use(s.withRecovery)
 	r.Use(s.withLogging)
 	r.Use(withTimeout(15 * time.Second))
@@ -47,9 +89,27 @@ func (s *Server) Router() http.Handler {
 		w.WriteHeader(http.StatusOK)
 	}).Methods(http.MethodGet)
 
+	// metrics
+	if s.metrics != nil {
+		r.Handle("/metrics", promhttp.HandlerFor(s.metrics, promhttp.HandlerOpts{})).Methods(http.MethodGet)
+	}
+
 	// API
 	r.HandleFunc("/orders/{order_uid}", s.GetOrder).Methods(http.MethodGet)
 
+	// admin; без токена администратора маршруты не регистрируются
+	if s.adminToken != "" {
+		admin := r.PathPrefix("/admin").Subrouter()
+		admin.Use(s.withAdminAuth)
+		admin.HandleFunc("/cache/stats", s.CacheStats).Methods(http.MethodGet)
+		admin.HandleFunc("/cache", s.InvalidateCache).Methods(http.MethodDelete)
+		admin.HandleFunc("/cache/{order_uid}", s.InvalidateCachedOrder).Methods(http.MethodDelete)
+		admin.HandleFunc("/log/level", s.GetLogLevel).Methods(http.MethodGet)
+		admin.HandleFunc("/log/level", s.SetLogLevel).Methods(http.MethodPut)
+	} else {
+		r.PathPrefix("/admin").Handler(http.NotFoundHandler())
+	}
+
 	// Static files
 	webDir := filepath.Clean("./web")
 	fs := http.FileServer(http.Dir(webDir))
@@ -66,6 +126,9 @@ func (s *Server) Start() error {
 		Handler: s.Router(),
 	}
 	s.log.Infow("HTTP server listening", "addr", addr)
+	if s.adminToken == "" {
+		s.log.Warn("admin api is disabled: server.admin_token is not set")
+	}
 
 	if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		s.log.Errorw("http server error", "err", err)
@@ -86,59 +149,161 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return nil
 }
 
-// обработчик запроса на получение заказа по UID
+// обработчик запроса на получение заказа по UID; персональные данные маскируются по роли вызывающего
 func (s *Server) GetOrder(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	vars := mux.Vars(r)
 	orderUID := vars["order_uid"]
 	if orderUID == "" {
-		s.log.Warn("missing order_uid in path")
+		logger.FromContext(ctx, s.log).Warn("missing order_uid in path")
 		http.Error(w, "missing order_uid", http.StatusBadRequest)
 		return
 	}
 
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("order.uid", orderUID))
+	role := s.callerRole(r)
+	ctx = logger.With(ctx, "order_uid", orderUID, "role", string(role))
+	log := logger.FromContext(ctx, s.log)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	// ответ зависит от токена в Authorization
+	w.Header().Add("Vary", "Authorization")
 
-	if order, ok := s.cache.Get(orderUID); ok && order != nil {
-		s.log.Infow("order fetched from cache", "order_uid", orderUID)
-		if err := json.NewEncoder(w).Encode(order); err != nil {
-			s.log.Errorw("failed to encode order (cache)", "order_uid", orderUID, "err", err)
+	mask := role.maskMode()
+	if enc, ok := s.cache.GetEncoded(orderUID); ok {
+		s.httpMetrics.cacheLookup(cacheHit)
+		log.Info("order fetched from cache")
+		// маскированное представление строится один раз на запись кэша и режим
+		enc, err := enc.Masked(mask)
+		if err != nil {
+			log.Errorw("failed to encode order (cache)", "err", err)
 			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
 		}
+		writeEncoded(w, r, enc)
 		return
 	}
 
-	order, err := s.repo.GetOrderByUID(ctx, orderUID)
+	if s.notFound.Contains(orderUID) {
+		s.httpMetrics.cacheLookup(cacheNegativeHit)
+		log.Info("order not found (negative cache)")
+		http.Error(w, "order not found", http.StatusNotFound)
+		return
+	}
+
+	s.httpMetrics.cacheLookup(cacheMiss)
+	order, err := s.loadOrder(ctx, orderUID)
 	if err != nil {
 		if errors.Is(err, postgres.ErrOrderNotFound) {
-			s.log.Infow("order not found in db", "order_uid", orderUID)
+			log.Info("order not found in db")
 			http.Error(w, "order not found", http.StatusNotFound)
 			return
 		}
-		s.log.Errorw("failed to fetch order from db", "order_uid", orderUID, "err", err)
+		log.Errorw("failed to fetch order from db", "err", err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	s.cache.Set(orderUID, order)
-	s.log.Infow("order cached", "order_uid", orderUID)
-
-	if err := json.NewEncoder(w).Encode(order); err != nil {
-		s.log.Errorw("failed to encode order (db)", "order_uid", orderUID, "err", err)
+	if err := json.NewEncoder(w).Encode(pii.MaskOrder(order, mask)); err != nil {
+		log.Errorw("failed to encode order (db)", "err", err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
 }
 
+// loadOrder — загружает заказ из БД и кладёт его в кэш; одновременные промахи
+// по одному UID разделяют один запрос к репозиторию
+func (s *Server) loadOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	ch := s.loads.DoChan(orderUID, func() (any, error) {
+		// загрузка не должна прерываться, если отменён запрос, который её начал
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+
+		start := time.Now()
+		order, err := s.repo.GetOrderByUID(loadCtx, orderUID)
+		if sp, ok := s.cache.(storage.StatsProvider); ok {
+			sp.ObserveLoad(time.Since(start), err)
+		}
+		if err != nil {
+			if errors.Is(err, postgres.ErrOrderNotFound) {
+				s.notFound.Add(orderUID)
+			}
+			return nil, err
+		}
+		s.cache.Set(orderUID, order)
+		logger.FromContext(loadCtx, s.log).Info("order cached")
+		return order, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*models.Order), nil
+	}
+}
+
+// writeEncoded — отдаёт готовое представление заказа, выбирая сжатие по Accept-Encoding
+func writeEncoded(w http.ResponseWriter, r *http.Request, enc *storage.Encoded) {
+	body := enc.JSON()
+	switch negotiateEncoding(r.Header.Get("Accept-Encoding")) {
+	case "br":
+		if b := enc.Brotli(); b != nil {
+			w.Header().Set("Content-Encoding", "br")
+			body = b
+		}
+	case "gzip":
+		if b := enc.Gzip(); b != nil {
+			w.Header().Set("Content-Encoding", "gzip")
+			body = b
+		}
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	_, _ = w.Write(body)
+}
+
+// negotiateEncoding — выбирает br или gzip с наибольшим q из Accept-Encoding; пустая строка — без сжатия
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "br" && name != "gzip" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		// q=0 означает, что клиент не принимает это сжатие
+		if q <= 0 {
+			continue
+		}
+		// при равном весе предпочитаем br: он сжимает JSON лучше
+		if q > bestQ || (q == bestQ && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
 // middlewares
 
 type ctxKey string
 
 const ctxKeyReqID ctxKey = "req_id"
 
-// добавляет уникальный идентификатор запроса в контекст и заголовок
-func withRequestID(next http.Handler) http.Handler {
+// добавляет уникальный идентификатор запроса в контекст и заголовок;
+// логгер запроса в контексте пишет req_id в каждую запись
+func (s *Server) withRequestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id := r.Header.Get("X-Request-ID")
 		if id == "" {
@@ -146,6 +311,7 @@ func withRequestID(next http.Handler) http.Handler {
 		}
 		w.Header().Set("X-Request-ID", id)
 		ctx := context.WithValue(r.Context(), ctxKeyReqID, id)
+		ctx = logger.WithContext(ctx, s.log.With("req_id", id))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -166,13 +332,11 @@ func (s *Server) withLogging(next http.Handler) http.Handler {
 		start := time.Now()
 		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
 		next.ServeHTTP(sw, r)
-		rid, _ := r.Context().Value(ctxKeyReqID).(string)
-		s.log.Infow("http",
+		logger.FromContext(r.Context(), s.log).Infow("http",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status", sw.code,
 			"dur_ms", time.Since(start).Milliseconds(),
-			"req_id", rid,
 		)
 	})
 }
@@ -182,8 +346,7 @@ func (s *Server) withRecovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rec := recover(); rec != nil {
-				rid, _ := r.Context().Value(ctxKeyReqID).(string)
-				s.log.Errorw("panic", "err", rec, "req_id", rid)
+				logger.FromContext(r.Context(), s.log).Errorw("panic", "err", rec)
 				http.Error(w, "internal server error", http.StatusInternalServerError)
 			}
 		}()
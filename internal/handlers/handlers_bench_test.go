@@ -61,3 +61,46 @@ func BenchmarkGetOrder_WithCache(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkGetOrder_WithCacheGzip — отдача заранее сжатого ответа из кэша
+func BenchmarkGetOrder_WithCacheGzip(b *testing.B) {
+	cache := storage.NewMemoryStorage()
+	cache.Set("fast", &models.Order{OrderUID: "fast"})
+
+	server := newTestServer(new(mockRepo), cache)
+	router := server.Router()
+	// роль full получает представление без маскирования
+	req := adminRequest(http.MethodGet, "/orders/fast", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			b.Fatalf("unexpected status %d", w.Code)
+		}
+	}
+}
+
+// BenchmarkGetOrder_WithCacheMaskedGzip — роль по умолчанию: маскированный и сжатый ответ из кэша
+func BenchmarkGetOrder_WithCacheMaskedGzip(b *testing.B) {
+	cache := storage.NewMemoryStorage()
+	cache.Set("fast", &models.Order{OrderUID: "fast", Delivery: models.Delivery{Name: "Test Testov", Phone: "+9720000000"}})
+
+	server := newTestServer(new(mockRepo), cache)
+	router := server.Router()
+	req := httptest.NewRequest(http.MethodGet, "/orders/fast", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			b.Fatalf("unexpected status %d", w.Code)
+		}
+	}
+}
@@ -1,27 +1,45 @@
 package handlers
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
 	"github.com/MikhaylovMaks/wb_techl0/internal/models"
 	"github.com/MikhaylovMaks/wb_techl0/internal/repository/postgres"
 	"github.com/MikhaylovMaks/wb_techl0/internal/storage"
+	"github.com/andybalholm/brotli"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 type mockRepo struct {
 	mock.Mock
 }
 
-func (m *mockRepo) SaveOrder(ctx context.Context, order *models.Order) error {
+func (m *mockRepo) SaveOrder(ctx context.Context, order *models.Order) (postgres.SaveResult, error) {
 	args := m.Called(ctx, order)
-	return args.Error(0)
+	return args.Get(0).(postgres.SaveResult), args.Error(1)
+}
+
+func (m *mockRepo) SaveOrders(ctx context.Context, orders []*models.Order) ([]postgres.BatchResult, error) {
+	args := m.Called(ctx, orders)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]postgres.BatchResult), args.Error(1)
 }
 
 func (m *mockRepo) GetOrderByUID(ctx context.Context, uid string) (*models.Order, error) {
@@ -37,9 +55,39 @@ func (m *mockRepo) GetAllOrderUIDs(ctx context.Context) ([]string, error) {
 	return args.Get(0).([]string), args.Error(1)
 }
 
+func (m *mockRepo) StreamOrders(ctx context.Context, filter postgres.OrderFilter, pageSize int, fn func(page []postgres.StreamedOrder) error) error {
+	args := m.Called(ctx, filter, pageSize, fn)
+	return args.Error(0)
+}
+
+func (m *mockRepo) ChangeWatermark(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockRepo) DeletedSince(ctx context.Context, watermark int64) ([]string, error) {
+	args := m.Called(ctx, watermark)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockRepo) ApplyEvent(ctx context.Context, change models.Change) (postgres.EventOutcome, error) {
+	args := m.Called(ctx, change)
+	return args.Get(0).(postgres.EventOutcome), args.Error(1)
+}
+
+// токен администратора тестового сервера
+const testAdminToken = "secret"
+
 func newTestServer(repo postgres.OrderRepository, cache storage.Cache) *Server {
 	logger, _ := zap.NewDevelopment()
-	return NewServer(0, repo, cache, logger.Sugar())
+	return NewServer(config.Server{NotFoundTTL: time.Minute, AdminToken: testAdminToken}, repo, cache, nil, zap.NewAtomicLevel(), logger.Sugar())
+}
+
+// adminRequest — запрос к /admin/* с токеном тестового сервера
+func adminRequest(method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
 }
 
 func TestGetOrder_FromCache(t *testing.T) {
@@ -114,3 +162,137 @@ func TestGetOrder_BadRequest(t *testing.T) {
 
 	assert.Equal(t, http.StatusNotFound, w.Code) // mux вернёт 404
 }
+
+func TestGetOrder_ConcurrentMissesShareOneLoad(t *testing.T) {
+	cache := storage.NewMemoryStorage()
+	repo := new(mockRepo)
+	repo.On("GetOrderByUID", mock.Anything, "hot").
+		Return(&models.Order{OrderUID: "hot"}, nil).
+		Run(func(args mock.Arguments) { time.Sleep(50 * time.Millisecond) })
+
+	server := newTestServer(repo, cache)
+	router := server.Router()
+
+	const n = 20
+	var wg sync.WaitGroup
+	codes := make([]int, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/hot", nil))
+			codes[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		assert.Equal(t, http.StatusOK, code)
+	}
+	repo.AssertNumberOfCalls(t, "GetOrderByUID", 1)
+}
+
+func TestGetOrder_NotFoundIsCachedBriefly(t *testing.T) {
+	cache := storage.NewMemoryStorage()
+	repo := new(mockRepo)
+	repo.On("GetOrderByUID", mock.Anything, "missing").Return(nil, postgres.ErrOrderNotFound)
+
+	server := newTestServer(repo, cache)
+	router := server.Router()
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/missing", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+	repo.AssertNumberOfCalls(t, "GetOrderByUID", 1)
+
+	// появившийся в кэше заказ отдаётся, несмотря на запомненный промах
+	cache.Set("missing", &models.Order{OrderUID: "missing"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/missing", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGetOrder_CompressedFromCache(t *testing.T) {
+	cache := storage.NewMemoryStorage()
+	cache.Set("abc", &models.Order{OrderUID: "abc", Entry: "WBIL"})
+	router := newTestServer(new(mockRepo), cache).Router()
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+	for encoding, newReader := range decoders {
+		t.Run(encoding, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orders/abc", nil)
+			req.Header.Set("Accept-Encoding", encoding)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, encoding, w.Header().Get("Content-Encoding"))
+			assert.Contains(t, w.Header().Values("Vary"), "Accept-Encoding")
+
+			body, err := newReader(w.Body)
+			require.NoError(t, err)
+			var got models.Order
+			require.NoError(t, json.NewDecoder(body).Decode(&got))
+			assert.Equal(t, "WBIL", got.Entry)
+		})
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                        "",
+		"identity":                "",
+		"gzip":                    "gzip",
+		"gzip, deflate, br":       "br",
+		"br;q=0.5, gzip":          "gzip",
+		"br;q=0, gzip;q=0":        "",
+		"GZIP;q=0.8, br;q=0.7":    "gzip",
+		"deflate, gzip;q=invalid": "",
+	}
+	for header, want := range cases {
+		assert.Equal(t, want, negotiateEncoding(header), "Accept-Encoding: %q", header)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "Test counter."})
+	reg.MustRegister(counter)
+	counter.Inc()
+
+	logger, _ := zap.NewDevelopment()
+	server := NewServer(config.Server{}, new(mockRepo), storage.NewMemoryStorage(), reg, zap.NewAtomicLevel(), logger.Sugar())
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "test_total 1")
+}
+
+func TestGetOrder_LogsRequestFields(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	cache := storage.NewMemoryStorage()
+	cache.Set("abc", &models.Order{OrderUID: "abc"})
+	server := NewServer(config.Server{}, new(mockRepo), cache, nil, zap.NewAtomicLevel(), zap.New(core).Sugar())
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/abc", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	server.Router().ServeHTTP(httptest.NewRecorder(), req)
+
+	fetched := logs.FilterMessage("order fetched from cache").All()
+	require.Len(t, fetched, 1)
+	assert.Equal(t, "req-1", fetched[0].ContextMap()["req_id"])
+	assert.Equal(t, "abc", fetched[0].ContextMap()["order_uid"])
+	// запись о запросе тоже содержит req_id
+	access := logs.FilterMessage("http").All()
+	require.Len(t, access, 1)
+	assert.Equal(t, "req-1", access[0].ContextMap()["req_id"])
+}
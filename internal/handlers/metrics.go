@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// исходы обращения GetOrder к кэшу
+const (
+	cacheHit = "hit"
+	// UID недавно не нашёлся в БД (отрицательный кэш)
+	cacheNegativeHit = "negative_hit"
+	cacheMiss        = "miss"
+)
+
+// httpMetrics — метрики HTTP-сервера; методы допускают nil-получатель (метрики отключены)
+type httpMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+	cache    *prometheus.CounterVec
+}
+
+func newHTTPMetrics(reg prometheus.Registerer) *httpMetrics {
+	m := &httpMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "orders", Subsystem: "http", Name: "requests_total",
+			Help: "HTTP requests by route template, method and status.",
+		}, []string{"route", "method", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "orders", Subsystem: "http", Name: "request_duration_seconds",
+			Help:    "HTTP request latency by route template, method and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "orders", Subsystem: "http", Name: "requests_in_flight",
+			Help: "HTTP requests being served.",
+		}),
+		cache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "orders", Subsystem: "http", Name: "cache_lookups_total",
+			Help: "Order cache lookups from GET /orders/{order_uid} by result.",
+		}, []string{"result"}),
+	}
+	reg.MustRegister(m.requests, m.duration, m.inFlight, m.cache)
+	return m
+}
+
+func (m *httpMetrics) cacheLookup(result string) {
+	if m == nil {
+		return
+	}
+	m.cache.WithLabelValues(result).Inc()
+}
+
+// учёт запросов, их длительности и числа обрабатываемых; маршрут берётся
+// из шаблона mux, чтобы order_uid не попадал в метки
+func (s *Server) withMetrics(next http.Handler) http.Handler {
+	m := s.httpMetrics
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		route := routeTemplate(r)
+		status := strconv.Itoa(sw.code)
+		m.requests.WithLabelValues(route, r.Method, status).Inc()
+		m.duration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/repository/postgres"
+	"github.com/MikhaylovMaks/wb_techl0/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+)
+
+func TestMetrics_RequestsAndCacheLookups(t *testing.T) {
+	cache := storage.NewMemoryStorage()
+	cache.Set("cached", &models.Order{OrderUID: "cached"})
+	repo := new(mockRepo)
+	repo.On("GetOrderByUID", mock.Anything, "missing").Return(nil, postgres.ErrOrderNotFound).Once()
+
+	reg := prometheus.NewRegistry()
+	server := NewServer(config.Server{NotFoundTTL: time.Minute}, repo, cache, reg, zap.NewAtomicLevel(), zap.NewNop().Sugar())
+	router := server.Router()
+	for _, uid := range []string{"cached", "missing", "missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/"+uid, nil))
+	}
+
+	m := server.httpMetrics
+	// метка маршрута — шаблон mux, а не путь с order_uid
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("/orders/{order_uid}", http.MethodGet, "200")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("/orders/{order_uid}", http.MethodGet, "404")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.requests))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.inFlight))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.cache.WithLabelValues(cacheHit)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.cache.WithLabelValues(cacheMiss)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.cache.WithLabelValues(cacheNegativeHit)))
+	repo.AssertExpectations(t)
+}
+
+func TestMetrics_PanicIsCountedAs500(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	// кэш без реализации паникует при первом обращении
+	server := NewServer(config.Server{}, new(mockRepo), struct{ storage.Cache }{}, reg, zap.NewAtomicLevel(), zap.NewNop().Sugar())
+	router := server.Router()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/boom", nil))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(server.httpMetrics.requests.WithLabelValues("/orders/{order_uid}", http.MethodGet, "500")))
+}
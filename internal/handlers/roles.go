@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+	"github.com/MikhaylovMaks/wb_techl0/internal/pii"
+)
+
+// Role — роль вызывающего API; от неё зависит маскирование персональных данных в ответах
+type Role string
+
+const (
+	// данные без маскирования
+	RoleFull Role = "full"
+	// служба поддержки: частичное маскирование, телефон виден как +7******1234
+	RoleSupport Role = "support"
+	// персональные данные скрыты полностью
+	RolePublic Role = "public"
+)
+
+// ParseRole проверяет название роли из настроек
+func ParseRole(s string) (Role, error) {
+	switch r := Role(s); r {
+	case RoleFull, RoleSupport, RolePublic:
+		return r, nil
+	}
+	return "", fmt.Errorf("unknown role %q", s)
+}
+
+// CheckRoles проверяет роль по умолчанию и роли токенов из настроек сервера
+func CheckRoles(cfg config.Server) error {
+	if _, err := ParseRole(cfg.DefaultRole); err != nil {
+		return fmt.Errorf("server default_role: %w", err)
+	}
+	for _, role := range cfg.RoleTokens {
+		if _, err := ParseRole(role); err != nil {
+			return fmt.Errorf("server role_tokens: %w", err)
+		}
+	}
+	return nil
+}
+
+// maskMode — маскирование для роли; неизвестная роль видит данные скрытыми
+func (r Role) maskMode() pii.MaskMode {
+	switch r {
+	case RoleFull:
+		return pii.MaskNone
+	case RoleSupport:
+		return pii.MaskPartial
+	}
+	return pii.MaskFull
+}
+
+// callerRole — роль по токену из заголовка Authorization: Bearer <token>;
+// токен администратора даёт full, без известного токена — роль по умолчанию
+func (s *Server) callerRole(r *http.Request) Role {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return s.defaultRole
+	}
+	if s.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1 {
+		return RoleFull
+	}
+	for t, role := range s.roleTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return role
+		}
+	}
+	return s.defaultRole
+}
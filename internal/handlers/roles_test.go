@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/pii"
+	"github.com/MikhaylovMaks/wb_techl0/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestGetOrder_MasksByRole(t *testing.T) {
+	order := &models.Order{OrderUID: "abc", Delivery: models.Delivery{
+		Name: "Test Testov", Phone: "+79161231234", Address: "Ploshad Mira 15", Email: "test@gmail.com"}}
+	cache := storage.NewMemoryStorage()
+	cache.Set("abc", order)
+	repo := new(mockRepo)
+	repo.On("GetOrderByUID", mock.Anything, "def").Return(&models.Order{OrderUID: "def", Delivery: order.Delivery}, nil)
+
+	cfg := config.Server{
+		NotFoundTTL: time.Minute,
+		AdminToken:  "admin",
+		DefaultRole: string(RolePublic),
+		RoleTokens:  map[string]string{"sup": string(RoleSupport)},
+	}
+	require.NoError(t, CheckRoles(cfg))
+	router := NewServer(cfg, repo, cache, nil, zap.NewAtomicLevel(), zap.NewNop().Sugar()).Router()
+
+	cases := []struct {
+		token string
+		want  models.Delivery
+	}{
+		{"admin", order.Delivery},
+		{"sup", models.Delivery{Name: "T*** T***", Phone: "+7******1234", Address: pii.Redacted, Email: "t***@gmail.com"}},
+		{"", models.Delivery{Name: pii.Redacted, Phone: pii.Redacted, Address: pii.Redacted, Email: pii.Redacted}},
+		{"unknown", models.Delivery{Name: pii.Redacted, Phone: pii.Redacted, Address: pii.Redacted, Email: pii.Redacted}},
+	}
+	for _, c := range cases {
+		// abc — из кэша, def — из БД
+		for _, uid := range []string{"abc", "def"} {
+			req := httptest.NewRequest(http.MethodGet, "/orders/"+uid, nil)
+			if c.token != "" {
+				req.Header.Set("Authorization", "Bearer "+c.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Header().Values("Vary"), "Authorization")
+
+			var got models.Order
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			assert.Equal(t, c.want, got.Delivery, "token %q, order %s", c.token, uid)
+		}
+	}
+	// в кэше остаются полные данные
+	cached, _ := cache.Get("abc")
+	assert.Equal(t, "+79161231234", cached.Delivery.Phone)
+}
+
+func TestCheckRoles(t *testing.T) {
+	assert.NoError(t, CheckRoles(config.Server{DefaultRole: "support"}))
+	assert.Error(t, CheckRoles(config.Server{DefaultRole: "root"}))
+	assert.Error(t, CheckRoles(config.Server{DefaultRole: "full", RoleTokens: map[string]string{"t": "admin"}}))
+}
+
+func TestGetOrder_AnonymousIsMaskedByDefault(t *testing.T) {
+	cache := storage.NewMemoryStorage()
+	cache.Set("abc", &models.Order{OrderUID: "abc", Delivery: models.Delivery{Phone: "+79161231234"}})
+	router := NewServer(config.Server{}, new(mockRepo), cache, nil, zap.NewAtomicLevel(), zap.NewNop().Sugar()).Router()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/abc", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var got models.Order
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, pii.Redacted, got.Delivery.Phone)
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/storage"
+	"github.com/MikhaylovMaks/wb_techl0/pkg/tracing/tracingtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestTracing_ServerSpan(t *testing.T) {
+	exporter := tracingtest.NewExporter(t)
+
+	cache := storage.NewMemoryStorage()
+	cache.Set("abc", &models.Order{OrderUID: "abc"})
+	server := newTestServer(new(mockRepo), cache)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/abc", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	server.Router().ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /orders/{order_uid}", span.Name)
+	// спан продолжает трассировку клиента
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+	assert.Contains(t, span.Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+	assert.Contains(t, span.Attributes, attribute.String("order.uid", "abc"))
+}
@@ -2,92 +2,477 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/maphash"
+	"sync"
 	"time"
 
+	"github.com/MikhaylovMaks/wb_techl0/internal/codec"
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+	"github.com/MikhaylovMaks/wb_techl0/internal/envelope"
 	"github.com/MikhaylovMaks/wb_techl0/internal/models"
 	"github.com/MikhaylovMaks/wb_techl0/internal/repository/postgres"
 	"github.com/MikhaylovMaks/wb_techl0/internal/storage"
+	"github.com/MikhaylovMaks/wb_techl0/pkg/logger"
+	"github.com/MikhaylovMaks/wb_techl0/pkg/retry"
 	"github.com/go-playground/validator/v10"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+// пауза между попытками записи в DLQ, пока Kafka недоступна
+const dlqRetryInterval = time.Second
+
+// размер очереди сообщений одного обработчика
+const workerQueueSize = 64
+
+// порядок обработки сообщений при нескольких обработчиках
+const (
+	// сообщения одной партиции обрабатываются последовательно
+	OrderingPartition = "partition"
+	// последовательно обрабатываются только сообщения с одинаковым ключом (order_uid)
+	OrderingKey = "key"
+)
+
 // структура Kafka-консюмера
 type Consumer struct {
-	reader *kafka.Reader
-	repo   postgres.OrderRepository
-	cache  storage.Cache
-	log    *zap.SugaredLogger
-	v      *validator.Validate
+	reader   messageReader
+	dlq      messageWriter // nil, если DLQ отключён
+	dlqTopic string
+	workers  int
+	ordering string
+	// заказы сохраняются пакетами до batchSize штук, пакет ждёт не дольше batchWindow
+	batchSize   int
+	batchWindow time.Duration
+	seed        maphash.Seed
+	tracker     *commitTracker
+	retry       retry.Policy
+	codecs      *codec.Set
+	repo        postgres.OrderRepository
+	cache       storage.Cache
+	metrics     *Metrics // nil — метрики не собираются
+	log         *zap.SugaredLogger
+	v           *validator.Validate
 }
 
-// конструктор Kafka Consumer
-func NewConsumer(brokers []string, topic, groupID string, repo postgres.OrderRepository, cache storage.Cache, log *zap.SugaredLogger) *Consumer {
+// конструктор Kafka Consumer; при пустом cfg.DLQTopic отклонённые сообщения только логируются.
+// Формат сообщения выбирается по заголовку content-type, без заголовка — формат codecs по умолчанию.
+// metrics может быть nil
+func NewConsumer(cfg config.Kafka, codecs *codec.Set, repo postgres.OrderRepository, cache storage.Cache, metrics *Metrics, log *zap.SugaredLogger) *Consumer {
 	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  brokers,
-		Topic:    topic,
-		GroupID:  groupID,
+		Brokers:  []string{cfg.Broker},
+		Topic:    cfg.Topic,
+		GroupID:  cfg.GroupID,
 		MinBytes: 10e3,
 		MaxBytes: 10e6,
 	})
-	return &Consumer{
-		reader: r,
-		repo:   repo,
-		cache:  cache,
-		log:    log,
-		v:      validator.New(),
+	c := &Consumer{
+		reader:      r,
+		dlqTopic:    cfg.DLQTopic,
+		workers:     cfg.Workers,
+		ordering:    cfg.Ordering,
+		batchSize:   cfg.BatchSize,
+		batchWindow: cfg.BatchWindow,
+		seed:        maphash.MakeSeed(),
+		retry:       retry.FromConfig(cfg.Retry, postgres.IsRetryable),
+		codecs:      codecs,
+		repo:        repo,
+		cache:       cache,
+		metrics:     metrics,
+		log:         log,
+		v:           validator.New(),
+	}
+	metrics.watchReader(r)
+	if cfg.DLQTopic != "" {
+		c.dlq = &kafka.Writer{
+			Addr:                   kafka.TCP(cfg.Broker),
+			Topic:                  cfg.DLQTopic,
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+		}
 	}
+	return c
 }
 
-// запускает обработку сообщений из Kafka
+// запускает обработку сообщений из Kafka: сообщения раскладываются по обработчикам
+// так, чтобы сообщения одной партиции (или одного ключа) обрабатывались по порядку
 func (c *Consumer) Start(ctx context.Context) {
-	defer c.reader.Close()
-	c.log.Info("Kafka consumer started")
+	defer c.close()
+	c.tracker = newCommitTracker()
+	queues := make([]chan kafka.Message, max(c.workers, 1))
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, workerQueueSize)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			c.work(ctx, queue)
+		}(queues[i])
+	}
+	defer func() {
+		for _, q := range queues {
+			close(q)
+		}
+		wg.Wait()
+		if n := c.tracker.pending(); n > 0 {
+			c.log.Infow("uncommitted messages will be redelivered", "count", n)
+		}
+		c.log.Info("Kafka consumer stopped")
+	}()
+
+	c.log.Infow("Kafka consumer started", "dlq_topic", c.dlqTopic, "workers", len(queues), "ordering", c.ordering)
 	for {
 		m, err := c.reader.FetchMessage(ctx)
 		if err != nil {
 			if errors.Is(err, context.Canceled) {
-				c.log.Info("Kafka consumer stopped")
 				return
 			}
 			c.log.Errorw("error fetching message", "err", err)
 			continue
 		}
+		c.tracker.track(m)
+		c.metrics.fetched(m)
+		select {
+		case queues[c.route(m, len(queues))] <- m:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-		var order models.Order
-		if err := json.Unmarshal(m.Value, &order); err != nil {
-			c.log.Warnw("invalid json", "err", err, "raw", string(m.Value))
-			_ = c.reader.CommitMessages(ctx, m)
-			continue
-		} // Валидация структуры заказа
-		if err := c.v.Struct(order); err != nil {
-			c.log.Warnw("validation failed", "err", err, "order_uid", order.OrderUID)
-			_ = c.reader.CommitMessages(ctx, m)
-			continue
+// route — номер обработчика для сообщения
+func (c *Consumer) route(m kafka.Message, workers int) int {
+	if workers == 1 {
+		return 0
+	}
+	if c.ordering == OrderingKey && len(m.Key) > 0 {
+		return int(maphash.Bytes(c.seed, m.Key) % uint64(workers))
+	}
+	return m.Partition % workers
+}
+
+// сообщение с разобранным и проверенным заказом, ожидающее сохранения
+type pendingOrder struct {
+	msg   kafka.Message
+	order *models.Order
+	// контекст обработки сообщения: его спан (завершается после сохранения пакета)
+	// и логгер с partition, offset и order_uid
+	ctx context.Context
+}
+
+// work — цикл обработчика: копит заказы до batchSize штук или batchWindow и сохраняет их пакетом.
+// Перед событием, меняющим заказ, накопленный пакет сохраняется, чтобы событие не обогнало создание заказа
+func (c *Consumer) work(ctx context.Context, queue <-chan kafka.Message) {
+	batchSize := max(c.batchSize, 1)
+	batch := make([]pendingOrder, 0, batchSize)
+	var timer *time.Timer
+	var deadline <-chan time.Time
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, deadline = nil, nil
 		}
+		if len(batch) > 0 {
+			c.flush(ctx, batch)
+			for _, p := range batch {
+				trace.SpanFromContext(p.ctx).End()
+			}
+			batch = batch[:0]
+		}
+	}
 
-		if err := c.repo.SaveOrder(ctx, &order); err != nil {
-			// simple retry with fixed backoff
-			var saved bool
-			for attempt := 1; attempt <= 3; attempt++ {
-				if err := c.repo.SaveOrder(ctx, &order); err == nil {
-					saved = true
-					break
-				}
-				c.log.Warnw("retry save order", "attempt", attempt, "order_uid", order.OrderUID)
-				time.Sleep(500 * time.Millisecond)
+	for {
+		select {
+		case m, ok := <-queue:
+			if !ok {
+				flush()
+				return
 			}
-			if !saved {
-				c.log.Errorw("failed to save order after retries", "order_uid", order.OrderUID)
+			mctx, span := startProcessSpan(ctx, m)
+			mctx = logger.WithContext(mctx, c.log.With("partition", m.Partition, "offset", m.Offset))
+			event, ok := c.decode(mctx, m)
+			if !ok {
+				span.End()
 				continue
 			}
+			mctx = logger.With(mctx, "order_uid", event.OrderID())
+			created, ok := event.(*models.OrderCreated)
+			if !ok {
+				flush()
+				c.change(mctx, m, event)
+				span.End()
+				continue
+			}
+			batch = append(batch, pendingOrder{msg: m, order: created.Order, ctx: mctx})
+			if len(batch) >= batchSize {
+				flush()
+			} else if timer == nil {
+				timer = time.NewTimer(c.batchWindow)
+				deadline = timer.C
+			}
+		case <-deadline:
+			timer, deadline = nil, nil
+			flush()
+		}
+	}
+}
+
+// decode разбирает и проверяет событие; отклонённое сообщение уходит в DLQ
+func (c *Consumer) decode(ctx context.Context, m kafka.Message) (models.Event, bool) {
+	log := logger.FromContext(ctx, c.log)
+	contentType := headerValue(m.Headers, codec.HeaderContentType)
+	dec, err := c.codecs.ForContentType(contentType)
+	if err != nil {
+		log.Warnw("unsupported message format", "err", err, "content_type", contentType)
+		c.reject(ctx, m, ReasonUnsupportedType, err, 1)
+		return nil, false
+	}
+	event, err := dec.Decode(ctx, m.Value)
+	if err != nil {
+		switch {
+		case errors.Is(err, envelope.ErrUnsupportedVersion):
+			log.Warnw("unsupported message version", "err", err)
+			c.reject(ctx, m, ReasonUnsupportedVersion, err, 1)
+		case errors.Is(err, codec.ErrUnsupportedEvent):
+			log.Warnw("unsupported event", "err", err)
+			c.reject(ctx, m, ReasonUnsupportedEvent, err, 1)
+		case dec.Format() == codec.FormatJSON:
+			// персональные данные в теле маскирует логгер (logger.Redact)
+			log.Warnw("invalid json", "err", err, "raw", string(m.Value))
+			c.reject(ctx, m, ReasonInvalidJSON, err, 1)
+		default:
+			log.Warnw("failed to decode message", "err", err, "format", dec.Format(), "size", len(m.Value))
+			c.reject(ctx, m, ReasonDecodeFailed, err, 1)
+		}
+		return nil, false
+	} // Валидация структуры заказа
+	if err := c.v.Struct(event); err != nil {
+		log.Warnw("validation failed", "err", err, "event", event.EventType(), "order_uid", event.OrderID())
+		c.reject(ctx, m, ReasonValidationFailed, err, 1)
+		return nil, false
+	}
+	c.metrics.decodedEvent(dec.Format(), event.EventType())
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("order.uid", event.OrderID()), attribute.String("order.event", event.EventType()))
+	return event, true
+}
+
+// flush сохраняет накопленные заказы. Ошибка отдельного заказа не мешает остальным:
+// временные ошибки повторяются для этого заказа отдельно, постоянные отправляют его в DLQ
+func (c *Consumer) flush(ctx context.Context, batch []pendingOrder) {
+	if len(batch) == 1 {
+		c.store(batch[0].ctx, batch[0])
+		return
+	}
+
+	orders := make([]*models.Order, len(batch))
+	// спан пакета связан со спанами обработки всех его сообщений
+	links := make([]trace.Link, len(batch))
+	for i, p := range batch {
+		orders[i] = p.order
+		links[i] = trace.Link{SpanContext: trace.SpanContextFromContext(p.ctx)}
+	}
+	bctx, span := otel.Tracer(tracerName).Start(ctx, "save batch", trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("orders.batch.size", len(batch))))
+	policy := c.retry
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		logger.FromContext(bctx, c.log).Warnw("retry save batch", "attempt", attempt, "delay", delay, "size", len(orders), "err", err)
+	}
+	var results []postgres.BatchResult
+	started := time.Now()
+	attempts, err := policy.Do(bctx, func(ctx context.Context) error {
+		var err error
+		results, err = c.repo.SaveOrders(ctx, orders)
+		return err
+	})
+	c.metrics.saveDone(opSaveBatch, time.Since(started), attempts)
+	endSpan(span, err)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		// пакет не сохранён целиком — сохраняем по одному, чтобы отделить проблемный заказ
+		logger.FromContext(bctx, c.log).Warnw("failed to save batch, falling back to single saves", "size", len(batch), "attempts", attempts, "err", err)
+		for _, p := range batch {
+			c.store(p.ctx, p)
+		}
+		return
+	}
+
+	for i, res := range results {
+		p := batch[i]
+		switch {
+		case res.Err == nil:
+			c.apply(p.ctx, p, res.Result, attempts)
+		case postgres.IsRetryable(res.Err):
+			c.store(p.ctx, p)
+		default:
+			logger.FromContext(p.ctx, c.log).Errorw("failed to save order", "attempts", attempts, "err", res.Err)
+			c.reject(p.ctx, p.msg, ReasonSaveFailed, res.Err, attempts)
+		}
+	}
+}
+
+// store сохраняет один заказ с повторами и применяет результат
+func (c *Consumer) store(ctx context.Context, p pendingOrder) {
+	result, attempts, err := c.save(ctx, p.order)
+	if err != nil {
+		if ctx.Err() != nil {
+			// остановка сервиса: сообщение будет прочитано снова
+			return
+		}
+		logger.FromContext(ctx, c.log).Errorw("failed to save order", "attempts", attempts, "err", err)
+		c.reject(ctx, p.msg, ReasonSaveFailed, err, attempts)
+		return
+	}
+	c.apply(ctx, p, result, attempts)
+}
+
+// apply обновляет кэш по итогу сохранения и коммитит сообщение; конфликт уходит в DLQ
+func (c *Consumer) apply(ctx context.Context, p pendingOrder, result postgres.SaveResult, attempts int) {
+	order := p.order
+	log := logger.FromContext(ctx, c.log)
+	c.metrics.savedOrder(result.String())
+	switch result {
+	case postgres.SaveUnchanged:
+		log.Info("duplicate order ignored")
+	case postgres.SaveConflict:
+		log.Warn("order conflicts with stored version")
+		c.reject(ctx, p.msg, ReasonConflict, fmt.Errorf("order %s already stored with different content", order.OrderUID), attempts)
+		return
+	default:
+		// статус — из БД: перезапись не отменяет оплату или отмену заказа
+		c.cache.Set(order.OrderUID, order)
+		log.Infow("order saved", "result", result)
+	}
+	c.commit(ctx, p.msg)
+}
+
+// change применяет событие к сохранённому заказу и обновляет кэш; событие для неизвестного заказа,
+// пришедшее не по порядку или недопустимое в текущем статусе заказа, уходит в DLQ
+func (c *Consumer) change(ctx context.Context, m kafka.Message, event models.Event) {
+	ch, ok := event.(models.Change)
+	if !ok {
+		err := fmt.Errorf("event %s can't change an order", event.EventType())
+		c.reject(ctx, m, ReasonUnsupportedEvent, err, 1)
+		return
+	}
+	log := logger.FromContext(ctx, c.log).With("event", ch.EventType(), "sequence", ch.Seq())
+	policy := c.retry
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		log.Warnw("retry apply event", "attempt", attempt, "delay", delay, "err", err)
+	}
+	var out postgres.EventOutcome
+	started := time.Now()
+	attempts, err := policy.Do(ctx, func(ctx context.Context) error {
+		var err error
+		out, err = c.repo.ApplyEvent(ctx, ch)
+		return err
+	})
+	c.metrics.saveDone(opApplyEvent, time.Since(started), attempts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Errorw("failed to apply event", "attempts", attempts, "err", err)
+		c.reject(ctx, m, ReasonSaveFailed, err, attempts)
+		return
+	}
+
+	c.metrics.appliedEvent(ch.EventType(), out.Result.String())
+	switch out.Result {
+	case postgres.EventApplied:
+		c.cache.Set(out.Order.OrderUID, out.Order)
+		log.Infow("event applied", "status", out.Order.Status)
+	case postgres.EventDuplicate:
+		log.Info("duplicate event ignored")
+	default:
+		reason, cause := ReasonInvalidTransition, out.Reason
+		switch out.Result {
+		case postgres.EventUnknownOrder:
+			reason, cause = ReasonUnknownOrder, fmt.Errorf("order %s not found", ch.OrderID())
+		case postgres.EventOutOfOrder:
+			reason = ReasonOutOfOrder
+		}
+		log.Warnw("event rejected", "reason", reason, "err", cause)
+		c.reject(ctx, m, reason, cause, attempts)
+		return
+	}
+	c.commit(ctx, m)
+}
+
+// save сохраняет заказ, повторяя попытки при временных ошибках БД; возвращает итог и число попыток
+func (c *Consumer) save(ctx context.Context, order *models.Order) (postgres.SaveResult, int, error) {
+	policy := c.retry
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		logger.FromContext(ctx, c.log).Warnw("retry save order", "attempt", attempt, "delay", delay, "err", err)
+	}
+	var result postgres.SaveResult
+	started := time.Now()
+	attempts, err := policy.Do(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = c.repo.SaveOrder(ctx, order)
+		return err
+	})
+	c.metrics.saveDone(opSaveOrder, time.Since(started), attempts)
+	return result, attempts, err
+}
+
+// reject отправляет сообщение в DLQ и коммитит его; без DLQ сообщение только коммитится
+func (c *Consumer) reject(ctx context.Context, m kafka.Message, reason string, cause error, attempts int) {
+	c.metrics.rejectedMessage(reason)
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("orders.reject_reason", reason))
+	span.SetStatus(codes.Error, reason)
+	log := logger.FromContext(ctx, c.log)
+	if c.dlq != nil {
+		dl := deadLetter(m, reason, cause, attempts, time.Now())
+		// без записи в DLQ коммитить нельзя, иначе сообщение потеряется
+		for {
+			err := c.dlq.WriteMessages(ctx, dl)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			log.Errorw("failed to write message to dlq", "topic", c.dlqTopic, "err", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(dlqRetryInterval):
+			}
 		}
+		c.metrics.deadLettered(reason)
+		log.Warnw("message sent to dlq", "reason", reason, "topic", m.Topic)
+	} else {
+		log.Errorw("message dropped, dlq is disabled", "reason", reason)
+	}
+	c.commit(ctx, m)
+}
 
-		c.cache.Set(order.OrderUID, &order)
-		c.log.Infow("order saved", "order_uid", order.OrderUID)
+// commit отмечает сообщение обработанным; смещение фиксируется, когда обработаны все предыдущие
+func (c *Consumer) commit(ctx context.Context, m kafka.Message) {
+	elapsed := c.tracker.done(m, func(last kafka.Message) {
+		if err := c.reader.CommitMessages(ctx, last); err != nil {
+			c.log.Errorw("failed to commit message", "partition", last.Partition, "offset", last.Offset, "err", err)
+		}
+	})
+	c.metrics.processed(elapsed)
+}
 
-		_ = c.reader.CommitMessages(ctx, m)
+func (c *Consumer) close() {
+	if err := c.reader.Close(); err != nil {
+		c.log.Errorw("failed to close kafka reader", "err", err)
+	}
+	if c.dlq != nil {
+		if err := c.dlq.Close(); err != nil {
+			c.log.Errorw("failed to close dlq writer", "err", err)
+		}
 	}
 }
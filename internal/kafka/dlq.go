@@ -0,0 +1,102 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// заголовки, которыми помечаются сообщения в dead-letter топике
+const (
+	HeaderDLQReason    = "x-dlq-reason"
+	HeaderDLQError     = "x-dlq-error"
+	HeaderDLQTopic     = "x-dlq-original-topic"
+	HeaderDLQPartition = "x-dlq-original-partition"
+	HeaderDLQOffset    = "x-dlq-original-offset"
+	HeaderDLQAttempts  = "x-dlq-attempts"
+	HeaderDLQFailedAt  = "x-dlq-failed-at"
+	// сколько раз сообщение уже возвращалось из DLQ в основной топик
+	HeaderRedriveCount = "x-redrive-count"
+)
+
+// причины отправки сообщения в DLQ
+const (
+	ReasonInvalidJSON        = "invalid_json"
+	ReasonDecodeFailed       = "decode_failed"
+	ReasonUnsupportedVersion = "unsupported_version"
+	ReasonUnsupportedType    = "unsupported_content_type"
+	ReasonValidationFailed   = "validation_failed"
+	ReasonSaveFailed         = "save_failed"
+	ReasonConflict           = "conflict"
+	// события жизненного цикла
+	ReasonUnsupportedEvent  = "unsupported_event"
+	ReasonUnknownOrder      = "unknown_order"
+	ReasonOutOfOrder        = "out_of_order"
+	ReasonInvalidTransition = "invalid_transition"
+)
+
+// messageReader — часть *kafka.Reader, нужная консюмеру
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// messageWriter — часть *kafka.Writer, нужная для публикации в DLQ и redrive
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// deadLetter — копия исходного сообщения с заголовками о причине отказа.
+// Прежние x-dlq-* заголовки заменяются, остальные сохраняются
+func deadLetter(m kafka.Message, reason string, cause error, attempts int, failedAt time.Time) kafka.Message {
+	headers := withoutHeaders(m.Headers, func(key string) bool {
+		return strings.HasPrefix(key, "x-dlq-")
+	})
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQReason, Value: []byte(reason)},
+		kafka.Header{Key: HeaderDLQTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderDLQPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderDLQOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderDLQFailedAt, Value: []byte(failedAt.UTC().Format(time.RFC3339Nano))},
+	)
+	if cause != nil {
+		headers = append(headers, kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())})
+	}
+	return kafka.Message{Key: m.Key, Value: m.Value, Headers: headers}
+}
+
+// redriven — сообщение из DLQ, готовое к повторной отправке в основной топик
+func redriven(m kafka.Message) kafka.Message {
+	count, _ := strconv.Atoi(headerValue(m.Headers, HeaderRedriveCount))
+	headers := withoutHeaders(m.Headers, func(key string) bool {
+		return strings.HasPrefix(key, "x-dlq-") || key == HeaderRedriveCount
+	})
+	headers = append(headers, kafka.Header{Key: HeaderRedriveCount, Value: []byte(strconv.Itoa(count + 1))})
+	return kafka.Message{Key: m.Key, Value: m.Value, Headers: headers}
+}
+
+func withoutHeaders(headers []kafka.Header, drop func(key string) bool) []kafka.Header {
+	out := make([]kafka.Header, 0, len(headers)+7)
+	for _, h := range headers {
+		if drop(h.Key) {
+			continue
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+func headerValue(headers []kafka.Header, key string) string {
+	for _, h := range headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
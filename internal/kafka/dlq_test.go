@@ -0,0 +1,632 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/codec"
+	"github.com/MikhaylovMaks/wb_techl0/internal/faker"
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/repository/postgres"
+	"github.com/MikhaylovMaks/wb_techl0/internal/storage"
+	"github.com/MikhaylovMaks/wb_techl0/pkg/retry"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// errDBDown — временная сетевая ошибка, которую консьюмер повторяет
+var errDBDown = fmt.Errorf("begin tx failed: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+
+// fakeReader отдаёт заданные сообщения, затем ждёт отмены контекста
+type fakeReader struct {
+	mu        sync.Mutex
+	msgs      []kafka.Message
+	committed []kafka.Message
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if len(r.msgs) > 0 {
+		m := r.msgs[0]
+		r.msgs = r.msgs[1:]
+		r.mu.Unlock()
+		return m, nil
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+func (r *fakeReader) committedOffsets() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var offsets []int64
+	for _, m := range r.committed {
+		offsets = append(offsets, m.Offset)
+	}
+	return offsets
+}
+
+// fakeWriter запоминает записанные сообщения; первые failures записей завершаются ошибкой
+type fakeWriter struct {
+	mu       sync.Mutex
+	failures int
+	written  []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failures > 0 {
+		w.failures--
+		return errors.New("broker unavailable")
+	}
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+// stubRepo переопределяет только SaveOrder
+type stubRepo struct {
+	postgres.OrderRepository
+	save      func(*models.Order) (postgres.SaveResult, error)
+	saveBatch func([]*models.Order) ([]postgres.BatchResult, error)
+	apply     func(models.Change) (postgres.EventOutcome, error)
+}
+
+func (r stubRepo) ApplyEvent(_ context.Context, change models.Change) (postgres.EventOutcome, error) {
+	return r.apply(change)
+}
+
+func (r stubRepo) SaveOrders(_ context.Context, orders []*models.Order) ([]postgres.BatchResult, error) {
+	return r.saveBatch(orders)
+}
+
+func (r stubRepo) SaveOrder(_ context.Context, order *models.Order) (postgres.SaveResult, error) {
+	return r.save(order)
+}
+
+func saveOK(*models.Order) (postgres.SaveResult, error) {
+	return postgres.SaveInserted, nil
+}
+
+func newTestConsumer(reader *fakeReader, dlq *fakeWriter, save func(*models.Order) (postgres.SaveResult, error)) *Consumer {
+	c := &Consumer{
+		reader:   reader,
+		dlqTopic: "orders.dlq",
+		retry:    retry.Policy{MaxAttempts: 4, BaseDelay: time.Millisecond, Retryable: postgres.IsRetryable},
+		codecs:   jsonCodecs,
+		repo:     stubRepo{save: save},
+		cache:    storage.NewMemoryStorage(),
+		log:      zap.NewNop().Sugar(),
+		v:        validator.New(),
+	}
+	if dlq != nil {
+		c.dlq = dlq
+	}
+	return c
+}
+
+var jsonCodecs, _ = codec.NewSet(codec.FormatJSON, "test", nil, "orders-value")
+
+// validOrderJSON — случайный заказ, проходящий валидацию консюмера
+func validOrderJSON(t *testing.T) []byte {
+	t.Helper()
+	v := validator.New()
+	for {
+		order := faker.GenerateFakeOrder()
+		if v.Struct(order) != nil {
+			continue
+		}
+		data, err := json.Marshal(order)
+		require.NoError(t, err)
+		return data
+	}
+}
+
+func runConsumer(t *testing.T, c *Consumer, reader *fakeReader, wantCommits int) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Start(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) >= wantCommits }, 5*time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
+
+func header(m kafka.Message, key string) string {
+	return headerValue(m.Headers, key)
+}
+
+func TestConsumer_RejectedMessagesGoToDLQ(t *testing.T) {
+	valid := validOrderJSON(t)
+	invalid, err := json.Marshal(&models.Order{OrderUID: "no-fields"})
+	require.NoError(t, err)
+
+	reader := &fakeReader{msgs: []kafka.Message{
+		{Topic: "orders", Partition: 2, Offset: 10, Key: []byte("k"), Value: []byte("{not json")},
+		{Topic: "orders", Partition: 2, Offset: 11, Value: invalid},
+		{Topic: "orders", Partition: 2, Offset: 12, Value: valid},
+	}}
+	dlq := &fakeWriter{failures: 1}
+	c := newTestConsumer(reader, dlq, saveOK)
+
+	runConsumer(t, c, reader, 3)
+
+	assert.Equal(t, []int64{10, 11, 12}, reader.committedOffsets())
+	require.Len(t, dlq.written, 2)
+
+	first := dlq.written[0]
+	assert.Equal(t, []byte("k"), first.Key)
+	assert.Equal(t, []byte("{not json"), first.Value)
+	assert.Equal(t, ReasonInvalidJSON, header(first, HeaderDLQReason))
+	assert.Equal(t, "orders", header(first, HeaderDLQTopic))
+	assert.Equal(t, "2", header(first, HeaderDLQPartition))
+	assert.Equal(t, "10", header(first, HeaderDLQOffset))
+	assert.Equal(t, "1", header(first, HeaderDLQAttempts))
+	assert.NotEmpty(t, header(first, HeaderDLQError))
+	_, err = time.Parse(time.RFC3339Nano, header(first, HeaderDLQFailedAt))
+	assert.NoError(t, err)
+
+	assert.Equal(t, ReasonValidationFailed, header(dlq.written[1], HeaderDLQReason))
+}
+
+func TestConsumer_DecodesByContentType(t *testing.T) {
+	var order models.Order
+	require.NoError(t, json.Unmarshal(validOrderJSON(t), &order))
+	pb := codec.NewProtobuf(nil, "orders-value")
+	data, err := pb.Encode(context.Background(), &models.OrderCreated{Order: &order})
+	require.NoError(t, err)
+	contentType := func(v string) []kafka.Header {
+		return []kafka.Header{{Key: codec.HeaderContentType, Value: []byte(v)}}
+	}
+
+	reader := &fakeReader{msgs: []kafka.Message{
+		{Topic: "orders", Offset: 1, Value: data, Headers: contentType(codec.ContentTypeProtobuf)},
+		{Topic: "orders", Offset: 2, Value: []byte{0x0a, 0x10}, Headers: contentType(codec.ContentTypeProtobuf)},
+		{Topic: "orders", Offset: 3, Value: data, Headers: contentType("application/xml")},
+	}}
+	dlq := &fakeWriter{}
+	var saved []string
+	c := newTestConsumer(reader, dlq, func(o *models.Order) (postgres.SaveResult, error) {
+		saved = append(saved, o.OrderUID)
+		return postgres.SaveInserted, nil
+	})
+
+	runConsumer(t, c, reader, 3)
+
+	assert.Equal(t, []string{order.OrderUID}, saved)
+	require.Len(t, dlq.written, 2)
+	assert.Equal(t, ReasonDecodeFailed, header(dlq.written[0], HeaderDLQReason))
+	assert.Equal(t, ReasonUnsupportedType, header(dlq.written[1], HeaderDLQReason))
+}
+
+func TestConsumer_UnsupportedSchemaVersionGoesToDLQ(t *testing.T) {
+	future := []byte(`{"schema_version":99,"event_type":"order.created","payload":{}}`)
+	reader := &fakeReader{msgs: []kafka.Message{{Topic: "orders", Offset: 1, Value: future}}}
+	dlq := &fakeWriter{}
+	c := newTestConsumer(reader, dlq, saveOK)
+
+	runConsumer(t, c, reader, 1)
+
+	require.Len(t, dlq.written, 1)
+	assert.Equal(t, ReasonUnsupportedVersion, header(dlq.written[0], HeaderDLQReason))
+}
+
+func TestConsumer_SaveFailureGoesToDLQAfterRetries(t *testing.T) {
+	valid := validOrderJSON(t)
+
+	reader := &fakeReader{msgs: []kafka.Message{{Topic: "orders", Offset: 5, Value: valid}}}
+	dlq := &fakeWriter{}
+	var calls int
+	c := newTestConsumer(reader, dlq, func(*models.Order) (postgres.SaveResult, error) {
+		calls++
+		return 0, errDBDown
+	})
+
+	runConsumer(t, c, reader, 1)
+
+	assert.Equal(t, 4, calls)
+	require.Len(t, dlq.written, 1)
+	assert.Equal(t, ReasonSaveFailed, header(dlq.written[0], HeaderDLQReason))
+	assert.Equal(t, "4", header(dlq.written[0], HeaderDLQAttempts))
+	assert.Equal(t, errDBDown.Error(), header(dlq.written[0], HeaderDLQError))
+}
+
+func TestRedriver_MovesMessagesBack(t *testing.T) {
+	original := kafka.Message{Topic: "orders", Offset: 3, Key: []byte("k"), Value: []byte("payload"),
+		Headers: []kafka.Header{{Key: "trace", Value: []byte("t1")}}}
+	dead := deadLetter(original, ReasonSaveFailed, errors.New("boom"), 4, time.Now())
+	dead.Offset = 0
+
+	reader := &fakeReader{msgs: []kafka.Message{dead}}
+	writer := &fakeWriter{}
+	r := &Redriver{reader: reader, writer: writer, log: zap.NewNop().Sugar()}
+
+	n, err := r.Run(context.Background(), 0, 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []int64{0}, reader.committedOffsets())
+
+	require.Len(t, writer.written, 1)
+	back := writer.written[0]
+	assert.Equal(t, original.Key, back.Key)
+	assert.Equal(t, original.Value, back.Value)
+	assert.Equal(t, []kafka.Header{
+		{Key: "trace", Value: []byte("t1")},
+		{Key: HeaderRedriveCount, Value: []byte("1")},
+	}, back.Headers)
+
+	// при повторном попадании в DLQ счётчик переотправок сохраняется
+	again := deadLetter(back, ReasonSaveFailed, nil, 1, time.Now())
+	assert.Equal(t, "1", header(again, HeaderRedriveCount))
+	assert.Equal(t, "2", header(redriven(again), HeaderRedriveCount))
+}
+
+func TestConsumer_PermanentSaveErrorIsNotRetried(t *testing.T) {
+	valid := validOrderJSON(t)
+
+	reader := &fakeReader{msgs: []kafka.Message{{Topic: "orders", Offset: 7, Value: valid}}}
+	dlq := &fakeWriter{}
+	var calls int
+	c := newTestConsumer(reader, dlq, func(*models.Order) (postgres.SaveResult, error) {
+		calls++
+		return 0, fmt.Errorf("insert order failed: %w", &pgconn.PgError{Code: pgerrcode.CheckViolation})
+	})
+
+	runConsumer(t, c, reader, 1)
+
+	assert.Equal(t, 1, calls)
+	require.Len(t, dlq.written, 1)
+	assert.Equal(t, "1", header(dlq.written[0], HeaderDLQAttempts))
+}
+
+func TestConsumer_SaveResults(t *testing.T) {
+	valid := validOrderJSON(t)
+	var order models.Order
+	require.NoError(t, json.Unmarshal(valid, &order))
+
+	results := []postgres.SaveResult{postgres.SaveUnchanged, postgres.SaveConflict, postgres.SaveUpdated}
+	reader := &fakeReader{msgs: []kafka.Message{
+		{Topic: "orders", Offset: 1, Value: valid},
+		{Topic: "orders", Offset: 2, Value: valid},
+		{Topic: "orders", Offset: 3, Value: valid},
+	}}
+	dlq := &fakeWriter{}
+	c := newTestConsumer(reader, dlq, func(*models.Order) (postgres.SaveResult, error) {
+		res := results[0]
+		results = results[1:]
+		return res, nil
+	})
+	cache := storage.NewMemoryStorage()
+	c.cache = cache
+
+	runConsumer(t, c, reader, 3)
+
+	// все сообщения закоммичены, в DLQ ушёл только конфликт
+	assert.Equal(t, []int64{1, 2, 3}, reader.committedOffsets())
+	require.Len(t, dlq.written, 1)
+	assert.Equal(t, ReasonConflict, header(dlq.written[0], HeaderDLQReason))
+	assert.Equal(t, "2", header(dlq.written[0], HeaderDLQOffset))
+
+	_, ok := cache.Get(order.OrderUID)
+	assert.True(t, ok)
+}
+
+func TestConsumer_ParallelPartitionsKeepOrder(t *testing.T) {
+	const partitions, perPartition = 4, 25
+	valid := validOrderJSON(t)
+	var base models.Order
+	require.NoError(t, json.Unmarshal(valid, &base))
+
+	// каждому сообщению свой order_uid вида "<партиция>-<смещение>"
+	reader := &fakeReader{}
+	for off := 0; off < perPartition; off++ {
+		for p := 0; p < partitions; p++ {
+			order := base
+			order.OrderUID = fmt.Sprintf("%d-%02d", p, off)
+			data, err := json.Marshal(&order)
+			require.NoError(t, err)
+			reader.msgs = append(reader.msgs, kafka.Message{Topic: "orders", Partition: p, Offset: int64(off), Value: data})
+		}
+	}
+
+	var mu sync.Mutex
+	saved := make(map[string][]string)
+	inFlight := make(map[string]bool)
+	c := newTestConsumer(reader, &fakeWriter{}, func(order *models.Order) (postgres.SaveResult, error) {
+		partition := order.OrderUID[:1]
+		mu.Lock()
+		overlap := inFlight[partition]
+		inFlight[partition] = true
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		inFlight[partition] = false
+		if overlap {
+			return 0, errors.New("partition processed concurrently")
+		}
+		saved[partition] = append(saved[partition], order.OrderUID)
+		return postgres.SaveInserted, nil
+	})
+	c.workers = partitions
+	c.ordering = OrderingPartition
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Start(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		var n int
+		for _, uids := range saved {
+			n += len(uids)
+		}
+		return n == partitions*perPartition
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	for p := 0; p < partitions; p++ {
+		uids := saved[fmt.Sprint(p)]
+		require.Len(t, uids, perPartition)
+		assert.IsIncreasing(t, uids, "partition %d", p)
+	}
+
+	// последний коммит каждой партиции — её последнее сообщение
+	last := make(map[int]int64)
+	for _, m := range reader.committed {
+		assert.GreaterOrEqual(t, m.Offset, last[m.Partition], "commits go backwards in partition %d", m.Partition)
+		last[m.Partition] = m.Offset
+	}
+	for p := 0; p < partitions; p++ {
+		assert.Equal(t, int64(perPartition-1), last[p])
+	}
+}
+
+func TestConsumer_RouteByKey(t *testing.T) {
+	c := &Consumer{ordering: OrderingKey, seed: maphash.MakeSeed()}
+	a := kafka.Message{Partition: 0, Key: []byte("order-a")}
+	b := kafka.Message{Partition: 3, Key: []byte("order-a")}
+	assert.Equal(t, c.route(a, 8), c.route(b, 8))
+
+	// без ключа — по партиции
+	assert.Equal(t, 3, c.route(kafka.Message{Partition: 3}, 8))
+}
+
+func TestConsumer_BatchIsolatesFailures(t *testing.T) {
+	reader := &fakeReader{}
+	for off := int64(0); off < 3; off++ {
+		reader.msgs = append(reader.msgs, kafka.Message{Topic: "orders", Offset: off, Value: validOrderJSON(t)})
+	}
+	dlq := &fakeWriter{}
+	var batches [][]*models.Order
+	var singles []string
+	c := newTestConsumer(reader, dlq, func(order *models.Order) (postgres.SaveResult, error) {
+		singles = append(singles, order.OrderUID)
+		return postgres.SaveInserted, nil
+	})
+	c.repo = stubRepo{
+		save: c.repo.(stubRepo).save,
+		saveBatch: func(orders []*models.Order) ([]postgres.BatchResult, error) {
+			batches = append(batches, orders)
+			return []postgres.BatchResult{
+				{Result: postgres.SaveInserted},
+				{Err: &pgconn.PgError{Code: pgerrcode.StringDataRightTruncationDataException}},
+				{Err: &pgconn.PgError{Code: pgerrcode.DeadlockDetected}},
+			}, nil
+		},
+	}
+	c.batchSize = 3
+	c.batchWindow = time.Hour
+
+	runConsumer(t, c, reader, 3)
+
+	require.Len(t, batches, 1)
+	assert.Len(t, batches[0], 3)
+	// временная ошибка повторяется для одного заказа, постоянная — в DLQ
+	assert.Equal(t, []string{batches[0][2].OrderUID}, singles)
+	require.Len(t, dlq.written, 1)
+	assert.Equal(t, "1", header(dlq.written[0], HeaderDLQOffset))
+	assert.Equal(t, ReasonSaveFailed, header(dlq.written[0], HeaderDLQReason))
+	assert.Equal(t, []int64{0, 1, 2}, reader.committedOffsets())
+}
+
+func TestConsumer_BatchFlushesOnWindow(t *testing.T) {
+	reader := &fakeReader{msgs: []kafka.Message{
+		{Topic: "orders", Offset: 0, Value: validOrderJSON(t)},
+		{Topic: "orders", Offset: 1, Value: validOrderJSON(t)},
+	}}
+	sizes := make(chan int, 1)
+	c := newTestConsumer(reader, &fakeWriter{}, saveOK)
+	c.repo = stubRepo{saveBatch: func(orders []*models.Order) ([]postgres.BatchResult, error) {
+		sizes <- len(orders)
+		results := make([]postgres.BatchResult, len(orders))
+		for i := range results {
+			results[i].Result = postgres.SaveInserted
+		}
+		return results, nil
+	}}
+	c.batchSize = 100
+	c.batchWindow = 20 * time.Millisecond
+
+	runConsumer(t, c, reader, 2)
+
+	assert.Equal(t, 2, <-sizes)
+	assert.Equal(t, []int64{0, 1}, reader.committedOffsets())
+}
+
+func TestConsumer_BatchErrorFallsBackToSingleSaves(t *testing.T) {
+	reader := &fakeReader{msgs: []kafka.Message{
+		{Topic: "orders", Offset: 0, Value: validOrderJSON(t)},
+		{Topic: "orders", Offset: 1, Value: validOrderJSON(t)},
+	}}
+	var singles int
+	c := newTestConsumer(reader, &fakeWriter{}, func(*models.Order) (postgres.SaveResult, error) {
+		singles++
+		return postgres.SaveInserted, nil
+	})
+	c.repo = stubRepo{
+		save: c.repo.(stubRepo).save,
+		saveBatch: func([]*models.Order) ([]postgres.BatchResult, error) {
+			return nil, &pgconn.PgError{Code: pgerrcode.ProgramLimitExceeded}
+		},
+	}
+	c.batchSize = 2
+
+	runConsumer(t, c, reader, 2)
+
+	assert.Equal(t, 2, singles)
+	assert.Equal(t, []int64{0, 1}, reader.committedOffsets())
+}
+
+func TestConsumer_LifecycleEvents(t *testing.T) {
+	raw := validOrderJSON(t)
+	var order models.Order
+	require.NoError(t, json.Unmarshal(raw, &order))
+	enc := codec.NewJSON("test")
+	event := func(e models.Event) []byte {
+		data, err := enc.Encode(context.Background(), e)
+		require.NoError(t, err)
+		return data
+	}
+	h := func(uid string, seq int64) models.ChangeHeader {
+		return models.ChangeHeader{OrderUID: uid, Sequence: seq}
+	}
+
+	reader := &fakeReader{msgs: []kafka.Message{
+		{Topic: "orders", Offset: 0, Value: raw},
+		{Topic: "orders", Offset: 1, Value: event(&models.OrderPaid{ChangeHeader: h(order.OrderUID, 1), Transaction: "t", PaymentDT: 42})},
+		{Topic: "orders", Offset: 2, Value: event(&models.OrderCancelled{ChangeHeader: h(order.OrderUID, 3)})},
+		{Topic: "orders", Offset: 3, Value: event(&models.OrderCancelled{ChangeHeader: h("unknown", 1)})},
+		{Topic: "orders", Offset: 4, Value: event(&models.OrderPaid{ChangeHeader: h(order.OrderUID, 2), Transaction: "t", PaymentDT: 43})},
+		{Topic: "orders", Offset: 5, Value: event(&models.OrderPaid{ChangeHeader: h(order.OrderUID, 1), Transaction: "t", PaymentDT: 42})},
+	}}
+	dlq := &fakeWriter{}
+	var calls []string
+	c := newTestConsumer(reader, dlq, func(o *models.Order) (postgres.SaveResult, error) {
+		calls = append(calls, "save "+o.OrderUID)
+		return postgres.SaveInserted, nil
+	})
+	stored := order.Clone()
+	var seq int64
+	c.repo = stubRepo{
+		save: c.repo.(stubRepo).save,
+		apply: func(ch models.Change) (postgres.EventOutcome, error) {
+			calls = append(calls, fmt.Sprintf("apply %s %d", ch.EventType(), ch.Seq()))
+			switch {
+			case ch.OrderID() != stored.OrderUID:
+				return postgres.EventOutcome{Result: postgres.EventUnknownOrder}, nil
+			case ch.Seq() <= seq:
+				return postgres.EventOutcome{Result: postgres.EventDuplicate}, nil
+			case ch.Seq() > seq+1:
+				return postgres.EventOutcome{Result: postgres.EventOutOfOrder, Reason: errors.New("gap")}, nil
+			}
+			if err := ch.Apply(stored); err != nil {
+				return postgres.EventOutcome{Result: postgres.EventRejected, Reason: err}, nil
+			}
+			seq = ch.Seq()
+			return postgres.EventOutcome{Result: postgres.EventApplied, Order: stored.Clone()}, nil
+		},
+	}
+	stored.Status = models.StatusCreated
+	c.batchSize = 10
+	c.batchWindow = time.Hour
+
+	runConsumer(t, c, reader, 6)
+
+	// заказ из пакета сохраняется раньше, чем к нему применяется событие
+	assert.Equal(t, "save "+order.OrderUID, calls[0])
+	assert.Equal(t, "apply order.paid 1", calls[1])
+
+	cached, ok := c.cache.Get(order.OrderUID)
+	require.True(t, ok)
+	assert.Equal(t, models.StatusPaid, cached.Status)
+	assert.Equal(t, int64(42), cached.Payment.PaymentDT)
+
+	reasons := make([]string, len(dlq.written))
+	for i, m := range dlq.written {
+		reasons[i] = header(m, HeaderDLQReason)
+	}
+	assert.Equal(t, []string{ReasonOutOfOrder, ReasonUnknownOrder, ReasonInvalidTransition}, reasons)
+	assert.Equal(t, []int64{0, 1, 2, 3, 4, 5}, reader.committedOffsets())
+}
+
+func TestConsumer_LogsMessageFields(t *testing.T) {
+	valid := validOrderJSON(t)
+	var order models.Order
+	require.NoError(t, json.Unmarshal(valid, &order))
+
+	reader := &fakeReader{msgs: []kafka.Message{
+		{Topic: "orders", Partition: 4, Offset: 9, Value: []byte("{not json")},
+		{Topic: "orders", Partition: 4, Offset: 10, Value: valid},
+	}}
+	c := newTestConsumer(reader, &fakeWriter{}, saveOK)
+	core, logs := observer.New(zapcore.InfoLevel)
+	c.log = zap.New(core).Sugar()
+
+	runConsumer(t, c, reader, 2)
+
+	rejected := logs.FilterMessage("message sent to dlq").All()
+	require.Len(t, rejected, 1)
+	assert.EqualValues(t, 4, rejected[0].ContextMap()["partition"])
+	assert.EqualValues(t, 9, rejected[0].ContextMap()["offset"])
+
+	saved := logs.FilterMessage("order saved").All()
+	require.Len(t, saved, 1)
+	assert.EqualValues(t, 10, saved[0].ContextMap()["offset"])
+	assert.Equal(t, order.OrderUID, saved[0].ContextMap()["order_uid"])
+}
+
+func TestConsumer_OverwriteKeepsStoredStatus(t *testing.T) {
+	var order models.Order
+	require.NoError(t, json.Unmarshal(validOrderJSON(t), &order))
+	// отправитель не может задать статус заказа
+	order.Status = models.StatusCancelled
+	data, err := json.Marshal(order)
+	require.NoError(t, err)
+
+	reader := &fakeReader{msgs: []kafka.Message{{Topic: "orders", Value: data}}}
+	// перезапись оплаченного заказа: репозиторий возвращает статус из БД
+	c := newTestConsumer(reader, &fakeWriter{}, func(o *models.Order) (postgres.SaveResult, error) {
+		o.Status = models.StatusPaid
+		return postgres.SaveUpdated, nil
+	})
+	runConsumer(t, c, reader, 1)
+
+	cached, ok := c.cache.Get(order.OrderUID)
+	require.True(t, ok)
+	assert.Equal(t, models.StatusPaid, cached.Status)
+}
@@ -3,6 +3,8 @@ package kafka
 import (
 	"testing"
 
+	"github.com/MikhaylovMaks/wb_techl0/internal/codec"
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
 	"github.com/MikhaylovMaks/wb_techl0/internal/repository/postgres"
 	"github.com/MikhaylovMaks/wb_techl0/internal/storage"
 	"go.uber.org/zap"
@@ -12,15 +14,16 @@ func TestNewConsumer(t *testing.T) {
 	log, _ := zap.NewDevelopment()
 	cache := storage.NewMemoryStorage()
 	var repo postgres.OrderRepository
-	consumer := NewConsumer([]string{"localhost:9092"}, "topic", "group", repo, cache, log.Sugar())
-	if consumer == nil || consumer.reader == nil {
+	cfg := config.Kafka{Broker: "localhost:9092", Topic: "topic", GroupID: "group", DLQTopic: "topic.dlq"}
+	consumer := NewConsumer(cfg, jsonCodecs, repo, cache, nil, log.Sugar())
+	if consumer == nil || consumer.reader == nil || consumer.dlq == nil {
 		t.Fatal("expected non-nil consumer")
 	}
 }
 
 func TestNewProducer(t *testing.T) {
 	log, _ := zap.NewDevelopment()
-	producer := NewProducer([]string{"localhost:9092"}, "topic", log.Sugar())
+	producer := NewProducer([]string{"localhost:9092"}, "topic", codec.NewJSON("test"), log.Sugar())
 	if producer == nil || producer.writer == nil {
 		t.Fatal("expected non-nil producer")
 	}
@@ -0,0 +1,220 @@
+package kafka
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// Metrics — метрики обработки сообщений консюмером. Методы допускают nil-получатель,
+// поэтому консюмер без метрик работает так же
+type Metrics struct {
+	reg        prometheus.Registerer
+	consumed   *prometheus.CounterVec
+	decoded    *prometheus.CounterVec
+	rejected   *prometheus.CounterVec
+	deadLetter *prometheus.CounterVec
+	saved      *prometheus.CounterVec
+	events     *prometheus.CounterVec
+	retries    *prometheus.CounterVec
+	processing prometheus.Histogram
+	saveTime   *prometheus.HistogramVec
+	lag        *prometheus.GaugeVec
+}
+
+// NewMetrics создаёт метрики консюмера и регистрирует их в reg
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		reg: reg,
+		consumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "orders", Subsystem: "kafka", Name: "messages_consumed_total",
+			Help: "Messages fetched from Kafka.",
+		}, []string{"topic"}),
+		decoded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "orders", Subsystem: "kafka", Name: "messages_decoded_total",
+			Help: "Messages decoded and validated, by format and event type.",
+		}, []string{"format", "event"}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "orders", Subsystem: "kafka", Name: "messages_rejected_total",
+			Help: "Messages rejected by the consumer, by reason.",
+		}, []string{"reason"}),
+		deadLetter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "orders", Subsystem: "kafka", Name: "messages_dead_lettered_total",
+			Help: "Rejected messages written to the DLQ, by reason.",
+		}, []string{"reason"}),
+		saved: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "orders", Subsystem: "kafka", Name: "orders_saved_total",
+			Help: "Orders saved from Kafka messages, by save result.",
+		}, []string{"result"}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "orders", Subsystem: "kafka", Name: "events_applied_total",
+			Help: "Lifecycle events applied to stored orders, by event type and result.",
+		}, []string{"event", "result"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "orders", Subsystem: "kafka", Name: "save_retries_total",
+			Help: "Database retries while saving orders and events, by operation.",
+		}, []string{"operation"}),
+		processing: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "orders", Subsystem: "kafka", Name: "message_processing_seconds",
+			Help:    "Time from fetching a message to marking it processed.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+		}),
+		saveTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "orders", Subsystem: "kafka", Name: "save_duration_seconds",
+			Help:    "Time spent saving to the database including retries, by operation.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+		}, []string{"operation"}),
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "orders", Subsystem: "kafka", Name: "partition_lag",
+			Help: "Messages behind the partition high water mark at the last fetch.",
+		}, []string{"topic", "partition"}),
+	}
+	reg.MustRegister(m.consumed, m.decoded, m.rejected, m.deadLetter, m.saved, m.events,
+		m.retries, m.processing, m.saveTime, m.lag)
+	return m
+}
+
+// операции сохранения для save_retries_total и save_duration_seconds
+const (
+	opSaveOrder  = "save_order"
+	opSaveBatch  = "save_batch"
+	opApplyEvent = "apply_event"
+)
+
+// fetched учитывает полученное сообщение и отставание его партиции
+func (m *Metrics) fetched(msg kafka.Message) {
+	if m == nil {
+		return
+	}
+	m.consumed.WithLabelValues(msg.Topic).Inc()
+	// HighWaterMark — смещение следующего сообщения партиции, 0 — неизвестно
+	if msg.HighWaterMark > 0 {
+		m.lag.WithLabelValues(msg.Topic, strconv.Itoa(msg.Partition)).Set(float64(max(msg.HighWaterMark-msg.Offset-1, 0)))
+	}
+}
+
+func (m *Metrics) decodedEvent(format, event string) {
+	if m == nil {
+		return
+	}
+	m.decoded.WithLabelValues(format, event).Inc()
+}
+
+func (m *Metrics) rejectedMessage(reason string) {
+	if m == nil {
+		return
+	}
+	m.rejected.WithLabelValues(reason).Inc()
+}
+
+func (m *Metrics) deadLettered(reason string) {
+	if m == nil {
+		return
+	}
+	m.deadLetter.WithLabelValues(reason).Inc()
+}
+
+func (m *Metrics) savedOrder(result string) {
+	if m == nil {
+		return
+	}
+	m.saved.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) appliedEvent(event, result string) {
+	if m == nil {
+		return
+	}
+	m.events.WithLabelValues(event, result).Inc()
+}
+
+// saveDone учитывает длительность сохранения и число повторов сверх первой попытки
+func (m *Metrics) saveDone(op string, elapsed time.Duration, attempts int) {
+	if m == nil {
+		return
+	}
+	m.saveTime.WithLabelValues(op).Observe(elapsed.Seconds())
+	if attempts > 1 {
+		m.retries.WithLabelValues(op).Add(float64(attempts - 1))
+	}
+}
+
+func (m *Metrics) processed(elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.processing.Observe(elapsed.Seconds())
+}
+
+// watchReader регистрирует метрики из статистики kafka.Reader
+func (m *Metrics) watchReader(r statsReader) {
+	if m == nil {
+		return
+	}
+	m.reg.MustRegister(newReaderCollector(r))
+}
+
+// statsReader — читатель, отдающий статистику (kafka.Reader)
+type statsReader interface {
+	Stats() kafka.ReaderStats
+}
+
+// readerCollector переводит kafka.ReaderStats в метрики. Счётчики в Stats() — приращения
+// с прошлого вызова, поэтому они накапливаются здесь
+type readerCollector struct {
+	r statsReader
+
+	mu                                           sync.Mutex
+	messages, bytes, errors, rebalances, fetches int64
+
+	messagesDesc, bytesDesc, errorsDesc, rebalancesDesc, fetchesDesc *prometheus.Desc
+	lagDesc, queueDesc                                               *prometheus.Desc
+}
+
+func newReaderCollector(r statsReader) *readerCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("orders", "kafka_reader", name), help, []string{"topic"}, nil)
+	}
+	return &readerCollector{
+		r:              r,
+		messagesDesc:   desc("messages_total", "Messages read by the Kafka reader."),
+		bytesDesc:      desc("bytes_total", "Message bytes read by the Kafka reader."),
+		errorsDesc:     desc("errors_total", "Errors reported by the Kafka reader."),
+		rebalancesDesc: desc("rebalances_total", "Consumer group rebalances."),
+		fetchesDesc:    desc("fetches_total", "Fetch requests sent by the Kafka reader."),
+		lagDesc:        desc("lag", "Lag reported by the Kafka reader for the last fetched partition."),
+		queueDesc:      desc("queue_length", "Messages fetched by the Kafka reader and not yet consumed."),
+	}
+}
+
+func (c *readerCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.messagesDesc, c.bytesDesc, c.errorsDesc, c.rebalancesDesc, c.fetchesDesc, c.lagDesc, c.queueDesc} {
+		ch <- d
+	}
+}
+
+func (c *readerCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.r.Stats()
+	c.mu.Lock()
+	c.messages += s.Messages
+	c.bytes += s.Bytes
+	c.errors += s.Errors
+	c.rebalances += s.Rebalances
+	c.fetches += s.Fetches
+	counters := map[*prometheus.Desc]int64{
+		c.messagesDesc:   c.messages,
+		c.bytesDesc:      c.bytes,
+		c.errorsDesc:     c.errors,
+		c.rebalancesDesc: c.rebalances,
+		c.fetchesDesc:    c.fetches,
+	}
+	c.mu.Unlock()
+	for d, v := range counters {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(v), s.Topic)
+	}
+	ch <- prometheus.MustNewConstMetric(c.lagDesc, prometheus.GaugeValue, float64(s.Lag), s.Topic)
+	ch <- prometheus.MustNewConstMetric(c.queueDesc, prometheus.GaugeValue, float64(s.QueueLength), s.Topic)
+}
@@ -0,0 +1,92 @@
+package kafka
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/repository/postgres"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumer_Metrics(t *testing.T) {
+	valid := validOrderJSON(t)
+
+	reader := &fakeReader{msgs: []kafka.Message{
+		{Topic: "orders", Partition: 1, Offset: 10, HighWaterMark: 20, Value: []byte("{not json")},
+		{Topic: "orders", Partition: 1, Offset: 11, HighWaterMark: 20, Value: valid},
+		{Topic: "orders", Partition: 1, Offset: 12, HighWaterMark: 20, Value: valid},
+	}}
+	dlq := &fakeWriter{}
+	var calls int
+	c := newTestConsumer(reader, dlq, func(*models.Order) (postgres.SaveResult, error) {
+		calls++
+		// второй заказ сохраняется с одним повтором
+		if calls == 2 {
+			return 0, errDBDown
+		}
+		return postgres.SaveInserted, nil
+	})
+	c.metrics = NewMetrics(prometheus.NewRegistry())
+
+	runConsumer(t, c, reader, 3)
+
+	m := c.metrics
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.consumed.WithLabelValues("orders")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.decoded.WithLabelValues("json", models.EventOrderCreated)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.rejected.WithLabelValues(ReasonInvalidJSON)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.deadLetter.WithLabelValues(ReasonInvalidJSON)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.saved.WithLabelValues("inserted")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.retries.WithLabelValues(opSaveOrder)))
+	// после сообщения со смещением 12 до HighWaterMark осталось 7 сообщений
+	assert.Equal(t, 7.0, testutil.ToFloat64(m.lag.WithLabelValues("orders", "1")))
+	var processing dto.Metric
+	require.NoError(t, m.processing.Write(&processing))
+	assert.EqualValues(t, 3, processing.GetHistogram().GetSampleCount())
+}
+
+// statsFunc — читатель со статистикой для readerCollector
+type statsFunc func() kafka.ReaderStats
+
+func (f statsFunc) Stats() kafka.ReaderStats { return f() }
+
+func TestReaderCollector_AccumulatesCounters(t *testing.T) {
+	// kafka.Reader.Stats() сбрасывает счётчики при каждом вызове
+	stats := statsFunc(func() kafka.ReaderStats {
+		return kafka.ReaderStats{Topic: "orders", Messages: 5, Errors: 1, Lag: 42}
+	})
+	reg := prometheus.NewRegistry()
+	NewMetrics(reg).watchReader(stats)
+
+	_, err := reg.Gather()
+	require.NoError(t, err)
+
+	expected := `
+# HELP orders_kafka_reader_lag Lag reported by the Kafka reader for the last fetched partition.
+# TYPE orders_kafka_reader_lag gauge
+orders_kafka_reader_lag{topic="orders"} 42
+# HELP orders_kafka_reader_messages_total Messages read by the Kafka reader.
+# TYPE orders_kafka_reader_messages_total counter
+orders_kafka_reader_messages_total{topic="orders"} 10
+# HELP orders_kafka_reader_errors_total Errors reported by the Kafka reader.
+# TYPE orders_kafka_reader_errors_total counter
+orders_kafka_reader_errors_total{topic="orders"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"orders_kafka_reader_lag", "orders_kafka_reader_messages_total", "orders_kafka_reader_errors_total"))
+}
+
+func TestMetrics_NilIsNoop(t *testing.T) {
+	var m *Metrics
+	assert.NotPanics(t, func() {
+		m.fetched(kafka.Message{Topic: "orders", HighWaterMark: 1})
+		m.rejectedMessage(ReasonInvalidJSON)
+		m.saveDone(opSaveOrder, 0, 3)
+		m.watchReader(nil)
+	})
+}
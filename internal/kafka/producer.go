@@ -2,10 +2,11 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"time"
 
+	"github.com/MikhaylovMaks/wb_techl0/internal/codec"
 	"github.com/MikhaylovMaks/wb_techl0/internal/faker"
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
 	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
 )
@@ -13,18 +14,22 @@ import (
 type Producer struct {
 	writer *kafka.Writer
 	topic  string
+	codec  codec.Codec
 	log    *zap.SugaredLogger
 }
 
-func NewProducer(brokers []string, topic string, log *zap.SugaredLogger) *Producer {
+// конструктор Producer; сообщения кодируются enc и помечаются заголовком content-type
+func NewProducer(brokers []string, topic string, enc codec.Codec, log *zap.SugaredLogger) *Producer {
 	return &Producer{
 		writer: &kafka.Writer{
-			Addr:         kafka.TCP(brokers...),
-			Topic:        topic,
-			Balancer:     &kafka.LeastBytes{},
+			Addr:  kafka.TCP(brokers...),
+			Topic: topic,
+			// ключ — order_uid, поэтому сообщения одного заказа попадают в одну партицию
+			Balancer:     &kafka.Hash{},
 			RequiredAcks: kafka.RequireAll,
 		},
 		topic: topic,
+		codec: enc,
 		log:   log,
 	}
 }
@@ -47,14 +52,8 @@ func (p *Producer) Start(ctx context.Context) {
 			return
 		case <-ticker.C:
 			order := faker.GenerateFakeOrder()
-			data, err := json.Marshal(order)
-			if err != nil {
-				p.log.Errorw("failed to marshal order", "err", err)
-				continue
-			}
-
 			writeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-			err = p.writer.WriteMessages(writeCtx, kafka.Message{Value: data})
+			err := p.send(writeCtx, order)
 			cancel()
 
 			if err != nil {
@@ -65,7 +64,25 @@ func (p *Producer) Start(ctx context.Context) {
 			p.log.Infow("order sent",
 				"order_uid", order.OrderUID,
 				"topic", p.topic,
+				"format", p.codec.Format(),
 			)
 		}
 	}
 }
+
+// send кодирует заказ и отправляет его с ключом order_uid
+func (p *Producer) send(ctx context.Context, order *models.Order) error {
+	data, err := p.codec.Encode(ctx, &models.OrderCreated{Order: order})
+	if err != nil {
+		return err
+	}
+	msgs := []kafka.Message{{
+		Key:     []byte(order.OrderUID),
+		Value:   data,
+		Headers: []kafka.Header{{Key: codec.HeaderContentType, Value: []byte(p.codec.ContentType())}},
+	}}
+	ctx, span := startPublishSpan(ctx, p.topic, msgs)
+	err = p.writer.WriteMessages(ctx, msgs...)
+	endSpan(span, err)
+	return err
+}
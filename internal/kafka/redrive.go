@@ -0,0 +1,71 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Redriver — возвращает сообщения из dead-letter топика в основной
+type Redriver struct {
+	reader messageReader
+	writer messageWriter
+	log    *zap.SugaredLogger
+}
+
+// конструктор Redriver; groupID — отдельная группа, в которой запоминается прогресс повторной отправки
+func NewRedriver(cfg config.Kafka, groupID string, log *zap.SugaredLogger) *Redriver {
+	return &Redriver{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: []string{cfg.Broker},
+			Topic:   cfg.DLQTopic,
+			GroupID: groupID,
+		}),
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Broker),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+		log: log,
+	}
+}
+
+// Run переотправляет до limit сообщений (0 — без ограничения) и завершается,
+// когда новых сообщений нет дольше idle; возвращает число переотправленных
+func (r *Redriver) Run(ctx context.Context, limit int, idle time.Duration) (int, error) {
+	var n int
+	for limit == 0 || n < limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, idle)
+		m, err := r.reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return n, nil
+			}
+			return n, fmt.Errorf("fetch dlq message: %w", err)
+		}
+		if err := r.writer.WriteMessages(ctx, redriven(m)); err != nil {
+			return n, fmt.Errorf("write message to main topic: %w", err)
+		}
+		if err := r.reader.CommitMessages(ctx, m); err != nil {
+			return n, fmt.Errorf("commit dlq message: %w", err)
+		}
+		n++
+		r.log.Infow("message redriven",
+			"reason", headerValue(m.Headers, HeaderDLQReason),
+			"original_partition", headerValue(m.Headers, HeaderDLQPartition),
+			"original_offset", headerValue(m.Headers, HeaderDLQOffset),
+		)
+	}
+	return n, nil
+}
+
+func (r *Redriver) Close() error {
+	return errors.Join(r.reader.Close(), r.writer.Close())
+}
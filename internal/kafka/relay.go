@@ -0,0 +1,167 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/codec"
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+	"github.com/MikhaylovMaks/wb_techl0/internal/envelope"
+	"github.com/MikhaylovMaks/wb_techl0/internal/repository/postgres"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// заголовок с ID события в outbox: при доставке «хотя бы раз» по нему можно отбросить повтор
+const HeaderOutboxID = "x-outbox-id"
+
+// как часто удаляются старые отправленные события
+const outboxCleanupInterval = time.Minute
+
+// на сколько relay забирает пакет событий; запись пакета в Kafka ограничена этим же сроком,
+// чтобы другая реплика не забрала события, пока их ещё отправляет эта
+const outboxClaimTTL = time.Minute
+
+// outboxStore — часть репозитория, нужная relay
+type outboxStore interface {
+	ClaimOutbox(ctx context.Context, limit int, ttl time.Duration) ([]postgres.OutboxMessage, error)
+	MarkOutboxSent(ctx context.Context, ids []int64, deleteSent bool) error
+	ReleaseOutbox(ctx context.Context, ids []int64) error
+	DeleteSentOutbox(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Relay публикует события из outbox в Kafka: забирает пакет событий, отправляет его и отмечает
+// отправленным только после подтверждения записи, поэтому при сбое события будут отправлены повторно
+type Relay struct {
+	store     outboxStore
+	writer    messageWriter
+	topic     string
+	producer  string
+	interval  time.Duration
+	batchSize int
+	retention time.Duration
+	log       *zap.SugaredLogger
+}
+
+// конструктор Relay; cfg.Topic должен быть задан, cfg.Interval — больше нуля
+func NewRelay(cfg config.Outbox, broker, producer string, store outboxStore, log *zap.SugaredLogger) *Relay {
+	return &Relay{
+		store: store,
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(broker),
+			Topic:                  cfg.Topic,
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+		},
+		topic:     cfg.Topic,
+		producer:  producer,
+		interval:  cfg.Interval,
+		batchSize: max(cfg.BatchSize, 1),
+		retention: cfg.Retention,
+		log:       log,
+	}
+}
+
+// Start раз в interval отправляет накопившиеся события, пока не будет отменён ctx
+func (r *Relay) Start(ctx context.Context) {
+	defer func() {
+		if err := r.writer.Close(); err != nil {
+			r.log.Errorw("failed to close outbox writer", "err", err)
+		}
+	}()
+	r.log.Infow("outbox relay started", "topic", r.topic)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	var lastCleanup time.Time
+	for {
+		if err := r.drain(ctx); err != nil && ctx.Err() == nil {
+			r.log.Errorw("failed to relay outbox", "err", err)
+		}
+		if r.retention > 0 && time.Since(lastCleanup) >= outboxCleanupInterval {
+			lastCleanup = time.Now()
+			if n, err := r.store.DeleteSentOutbox(ctx, lastCleanup.Add(-r.retention)); err != nil && ctx.Err() == nil {
+				r.log.Errorw("failed to clean up outbox", "err", err)
+			} else if n > 0 {
+				r.log.Infow("sent outbox events removed", "count", n)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			r.log.Info("outbox relay stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain отправляет события пакетами, пока outbox не опустеет
+func (r *Relay) drain(ctx context.Context) error {
+	for {
+		msgs, err := r.store.ClaimOutbox(ctx, r.batchSize, outboxClaimTTL)
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+		ids := make([]int64, len(msgs))
+		for i, m := range msgs {
+			ids[i] = m.ID
+		}
+
+		pubCtx, cancel := context.WithTimeout(ctx, outboxClaimTTL)
+		err = r.publish(pubCtx, msgs)
+		cancel()
+		if err != nil {
+			if relErr := r.store.ReleaseOutbox(ctx, ids); relErr != nil && ctx.Err() == nil {
+				r.log.Warnw("failed to release outbox events", "err", relErr)
+			}
+			return err
+		}
+		// если отметка не записалась, события отправятся повторно после истечения outboxClaimTTL
+		if err := r.store.MarkOutboxSent(ctx, ids, r.retention == 0); err != nil {
+			return err
+		}
+		r.log.Debugw("outbox events published", "count", len(msgs), "topic", r.topic)
+		if len(msgs) < r.batchSize {
+			return nil
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, msgs []postgres.OutboxMessage) error {
+	out := make([]kafka.Message, len(msgs))
+	for i, m := range msgs {
+		env := envelope.Envelope{
+			SchemaVersion: envelope.CurrentVersion,
+			EventType:     m.EventType,
+			Producer:      r.producer,
+			ProducedAt:    m.CreatedAt.UTC(),
+			Payload:       m.Payload,
+		}
+		value, err := json.Marshal(env)
+		if err != nil {
+			return err
+		}
+		out[i] = kafka.Message{
+			Key:   []byte(m.OrderUID),
+			Value: value,
+			Headers: []kafka.Header{
+				{Key: codec.HeaderContentType, Value: []byte(codec.ContentTypeJSON)},
+				{Key: HeaderOutboxID, Value: []byte(strconv.FormatInt(m.ID, 10))},
+			},
+		}
+	}
+	ctx, span := startPublishSpan(ctx, r.topic, out)
+	err := r.writer.WriteMessages(ctx, out...)
+	endSpan(span, err)
+	if err != nil {
+		return fmt.Errorf("publish outbox events: %w", err)
+	}
+	return nil
+}
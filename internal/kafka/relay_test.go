@@ -0,0 +1,152 @@
+package kafka
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/codec"
+	"github.com/MikhaylovMaks/wb_techl0/internal/envelope"
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/repository/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeOutbox — outbox в памяти с той же семантикой, что и у репозитория
+type fakeOutbox struct {
+	mu       sync.Mutex
+	pending  []postgres.OutboxMessage
+	claimed  map[int64]bool
+	sent     []int64
+	deleted  []int64
+	released []int64
+}
+
+func (o *fakeOutbox) ClaimOutbox(_ context.Context, limit int, _ time.Duration) ([]postgres.OutboxMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.claimed == nil {
+		o.claimed = make(map[int64]bool)
+	}
+	var msgs []postgres.OutboxMessage
+	for _, m := range o.pending {
+		if len(msgs) < limit && !o.claimed[m.ID] {
+			o.claimed[m.ID] = true
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs, nil
+}
+
+func (o *fakeOutbox) MarkOutboxSent(_ context.Context, ids []int64, deleteSent bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if deleteSent {
+		o.deleted = append(o.deleted, ids...)
+	} else {
+		o.sent = append(o.sent, ids...)
+	}
+	o.pending = slices.DeleteFunc(o.pending, func(m postgres.OutboxMessage) bool { return slices.Contains(ids, m.ID) })
+	return nil
+}
+
+func (o *fakeOutbox) ReleaseOutbox(_ context.Context, ids []int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, id := range ids {
+		delete(o.claimed, id)
+	}
+	o.released = append(o.released, ids...)
+	return nil
+}
+
+func (o *fakeOutbox) DeleteSentOutbox(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func newTestRelay(store outboxStore, w *fakeWriter, batchSize int, retention time.Duration) *Relay {
+	return &Relay{
+		store:     store,
+		writer:    w,
+		topic:     "orders.persisted",
+		producer:  "test",
+		interval:  time.Millisecond,
+		batchSize: batchSize,
+		retention: retention,
+		log:       zap.NewNop().Sugar(),
+	}
+}
+
+func TestRelay_PublishesAndMarksSent(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	store := &fakeOutbox{}
+	for id := int64(1); id <= 5; id++ {
+		store.pending = append(store.pending, postgres.OutboxMessage{
+			ID: id, OrderUID: "uid", EventType: models.EventOrderCreated, Payload: []byte(`{"order_uid":"uid"}`), CreatedAt: created,
+		})
+	}
+	w := &fakeWriter{}
+	r := newTestRelay(store, w, 2, time.Hour)
+
+	require.NoError(t, r.drain(context.Background()))
+
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, store.sent)
+	require.Len(t, w.written, 5)
+	m := w.written[0]
+	assert.Equal(t, []byte("uid"), m.Key)
+	assert.Equal(t, "1", header(m, HeaderOutboxID))
+	assert.Equal(t, codec.ContentTypeJSON, header(m, codec.HeaderContentType))
+
+	env, err := envelope.Parse(m.Value)
+	require.NoError(t, err)
+	assert.Equal(t, envelope.CurrentVersion, env.SchemaVersion)
+	assert.Equal(t, models.EventOrderCreated, env.EventType)
+	assert.Equal(t, "test", env.Producer)
+	assert.True(t, env.ProducedAt.Equal(created))
+	assert.JSONEq(t, `{"order_uid":"uid"}`, string(env.Payload))
+}
+
+func TestRelay_FailedPublishKeepsEvents(t *testing.T) {
+	store := &fakeOutbox{pending: []postgres.OutboxMessage{{ID: 7, OrderUID: "uid", EventType: models.EventOrderPaid, Payload: []byte(`{}`)}}}
+	w := &fakeWriter{failures: 1}
+	r := newTestRelay(store, w, 10, 0)
+
+	assert.Error(t, r.drain(context.Background()))
+	assert.Len(t, store.pending, 1)
+	assert.Equal(t, []int64{7}, store.released, "failed events are released at once")
+
+	// следующая попытка отправляет событие; без хранения оно сразу удаляется
+	require.NoError(t, r.drain(context.Background()))
+	assert.Empty(t, store.pending)
+	assert.Equal(t, []int64{7}, store.deleted)
+	assert.Len(t, w.written, 1)
+}
+
+func TestRelay_StartStopsOnCancel(t *testing.T) {
+	store := &fakeOutbox{pending: []postgres.OutboxMessage{{ID: 1, OrderUID: "uid", EventType: models.EventOrderCreated, Payload: []byte(`{}`)}}}
+	w := &fakeWriter{failures: 2}
+	r := newTestRelay(store, w, 10, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Start(ctx)
+		close(done)
+	}()
+	// relay повторяет отправку, пока брокер недоступен
+	require.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.sent) == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("relay did not stop after context cancellation")
+	}
+}
@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/repository/postgres"
+	"github.com/MikhaylovMaks/wb_techl0/pkg/tracing/tracingtest"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spansByName(spans tracetest.SpanStubs, name string) tracetest.SpanStubs {
+	var out tracetest.SpanStubs
+	for _, s := range spans {
+		if s.Name == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func TestConsumer_ContinuesProducerTrace(t *testing.T) {
+	exporter := tracingtest.NewExporter(t)
+
+	msgs := []kafka.Message{
+		{Topic: "orders", Partition: 3, Offset: 7, Key: []byte("k"), Value: validOrderJSON(t)},
+		{Topic: "orders", Partition: 3, Offset: 8, Value: []byte("{not json")},
+	}
+	_, publish := startPublishSpan(context.Background(), "orders", msgs)
+	publish.End()
+	assert.NotEmpty(t, header(msgs[0], "traceparent"))
+
+	reader := &fakeReader{msgs: msgs}
+	c := newTestConsumer(reader, &fakeWriter{}, saveOK)
+	runConsumer(t, c, reader, 2)
+
+	process := spansByName(exporter.GetSpans(), "process orders")
+	require.Len(t, process, 2)
+	for _, s := range process {
+		// обработка продолжает трассировку отправителя
+		assert.Equal(t, publish.SpanContext().TraceID(), s.SpanContext.TraceID())
+		assert.Equal(t, publish.SpanContext().SpanID(), s.Parent.SpanID())
+	}
+	assert.Equal(t, codes.Unset, process[0].Status.Code)
+	assert.Equal(t, codes.Error, process[1].Status.Code)
+	assert.Equal(t, ReasonInvalidJSON, process[1].Status.Description)
+}
+
+func TestConsumer_BatchSpanLinksMessages(t *testing.T) {
+	exporter := tracingtest.NewExporter(t)
+
+	reader := &fakeReader{msgs: []kafka.Message{
+		{Topic: "orders", Offset: 0, Value: validOrderJSON(t)},
+		{Topic: "orders", Offset: 1, Value: validOrderJSON(t)},
+	}}
+	c := newTestConsumer(reader, &fakeWriter{}, saveOK)
+	c.repo = stubRepo{saveBatch: func(orders []*models.Order) ([]postgres.BatchResult, error) {
+		return make([]postgres.BatchResult, len(orders)), nil
+	}}
+	c.batchSize = 2
+	c.batchWindow = time.Hour
+
+	runConsumer(t, c, reader, 2)
+
+	spans := exporter.GetSpans()
+	batch := spansByName(spans, "save batch")
+	require.Len(t, batch, 1)
+	process := spansByName(spans, "process orders")
+	require.Len(t, process, 2)
+	require.Len(t, batch[0].Links, 2)
+	for i, l := range batch[0].Links {
+		assert.Equal(t, process[i].SpanContext.SpanID(), l.SpanContext.SpanID())
+	}
+}
+
+func TestHeaderCarrier_SetReplaces(t *testing.T) {
+	headers := []kafka.Header{{Key: "traceparent", Value: []byte("old")}}
+	c := headerCarrier{headers: &headers}
+	c.Set("traceparent", "new")
+	c.Set("tracestate", "a=b")
+
+	assert.Equal(t, "new", c.Get("traceparent"))
+	assert.Equal(t, []string{"traceparent", "tracestate"}, c.Keys())
+}
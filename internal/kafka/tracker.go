@@ -0,0 +1,93 @@
+package kafka
+
+import (
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// commitTracker — учёт сообщений, обрабатываемых параллельно. Смещение партиции
+// коммитится только когда обработаны все полученные раньше сообщения этой партиции
+type commitTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	mu sync.Mutex
+	// сообщения в порядке получения, ещё не вошедшие в закоммиченный префикс
+	inflight []*trackedMessage
+}
+
+type trackedMessage struct {
+	msg     kafka.Message
+	fetched time.Time
+	done    bool
+}
+
+func newCommitTracker() *commitTracker {
+	return &commitTracker{partitions: make(map[int]*partitionOffsets)}
+}
+
+// track регистрирует полученное сообщение; вызывается в порядке чтения из партиции
+func (t *commitTracker) track(m kafka.Message) {
+	p := t.partition(m.Partition)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inflight = append(p.inflight, &trackedMessage{msg: m, fetched: time.Now()})
+}
+
+// done отмечает сообщение обработанным и, если перед ним не осталось незавершённых,
+// вызывает commit с последним сообщением непрерывного префикса. commit выполняется
+// под блокировкой партиции, поэтому смещения коммитятся по возрастанию.
+// Возвращает время с получения сообщения (0, если сообщение не отслеживалось)
+func (t *commitTracker) done(m kafka.Message, commit func(kafka.Message)) time.Duration {
+	p := t.partition(m.Partition)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var elapsed time.Duration
+	for _, tm := range p.inflight {
+		if tm.msg.Offset == m.Offset && !tm.done {
+			tm.done = true
+			elapsed = time.Since(tm.fetched)
+			break
+		}
+	}
+	var n int
+	for n < len(p.inflight) && p.inflight[n].done {
+		n++
+	}
+	if n == 0 {
+		return elapsed
+	}
+	last := p.inflight[n-1].msg
+	p.inflight = p.inflight[n:]
+	commit(last)
+	return elapsed
+}
+
+// pending — число ещё не закоммиченных сообщений во всех партициях
+func (t *commitTracker) pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var n int
+	for _, p := range t.partitions {
+		p.mu.Lock()
+		n += len(p.inflight)
+		p.mu.Unlock()
+	}
+	return n
+}
+
+func (t *commitTracker) partition(partition int) *partitionOffsets {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.partitions[partition]
+	if !ok {
+		p = &partitionOffsets{}
+		t.partitions[partition] = p
+	}
+	return p
+}
@@ -0,0 +1,40 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitTracker_CommitsContiguousPrefix(t *testing.T) {
+	tr := newCommitTracker()
+	msg := func(partition int, offset int64) kafka.Message {
+		return kafka.Message{Partition: partition, Offset: offset}
+	}
+	for _, off := range []int64{10, 11, 12, 13} {
+		tr.track(msg(0, off))
+	}
+	tr.track(msg(1, 5))
+
+	var commits []kafka.Message
+	commit := func(m kafka.Message) { commits = append(commits, m) }
+
+	// 11 и 12 готовы раньше 10 — коммитить нечего
+	tr.done(msg(0, 12), commit)
+	tr.done(msg(0, 11), commit)
+	assert.Empty(t, commits)
+
+	// другая партиция не ждёт первую
+	tr.done(msg(1, 5), commit)
+	assert.Equal(t, []kafka.Message{msg(1, 5)}, commits)
+
+	// 10 завершает префикс 10..12
+	tr.done(msg(0, 10), commit)
+	assert.Equal(t, msg(0, 12), commits[1])
+	assert.Equal(t, 1, tr.pending())
+
+	tr.done(msg(0, 13), commit)
+	assert.Equal(t, msg(0, 13), commits[2])
+	assert.Equal(t, 0, tr.pending())
+}
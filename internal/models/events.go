@@ -0,0 +1,167 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// типы событий жизненного цикла заказа
+const (
+	EventOrderCreated      = "order.created"
+	EventOrderPaid         = "order.paid"
+	EventItemStatusChanged = "order.item_status_changed"
+	EventDeliveryUpdated   = "order.delivery_updated"
+	EventOrderCancelled    = "order.cancelled"
+	// заказ перезаписан новым содержимым; только в исходящих событиях outbox
+	EventOrderUpdated = "order.updated"
+)
+
+// статусы заказа
+const (
+	StatusCreated   = "created"
+	StatusPaid      = "paid"
+	StatusCancelled = "cancelled"
+)
+
+var (
+	// событие недопустимо в текущем статусе заказа
+	ErrInvalidTransition = errors.New("invalid order status transition")
+	// событие ссылается на позицию, которой нет в заказе
+	ErrUnknownItem = errors.New("order has no such item")
+)
+
+// Event — событие жизненного цикла заказа
+type Event interface {
+	EventType() string
+	OrderID() string
+}
+
+// Change — событие, меняющее уже сохранённый заказ
+type Change interface {
+	Event
+	// номер изменения в истории заказа: события применяются строго по порядку, начиная с 1
+	Seq() int64
+	// Apply применяет событие к заказу или возвращает ErrInvalidTransition / ErrUnknownItem
+	Apply(o *Order) error
+}
+
+// NewEvent — пустое событие указанного типа для разбора payload
+func NewEvent(eventType string) (Event, bool) {
+	switch eventType {
+	case EventOrderCreated:
+		return &OrderCreated{}, true
+	case EventOrderPaid:
+		return &OrderPaid{}, true
+	case EventItemStatusChanged:
+		return &ItemStatusChanged{}, true
+	case EventDeliveryUpdated:
+		return &DeliveryUpdated{}, true
+	case EventOrderCancelled:
+		return &OrderCancelled{}, true
+	}
+	return nil, false
+}
+
+// OrderCreated — новый заказ целиком; в JSON payload события — сам заказ
+type OrderCreated struct {
+	Order *Order `validate:"required"`
+}
+
+func (e *OrderCreated) EventType() string { return EventOrderCreated }
+func (e *OrderCreated) OrderID() string   { return e.Order.OrderUID }
+
+func (e *OrderCreated) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.Order)
+}
+
+func (e *OrderCreated) UnmarshalJSON(data []byte) error {
+	e.Order = new(Order)
+	return json.Unmarshal(data, e.Order)
+}
+
+// ChangeHeader — общие поля событий, меняющих заказ
+type ChangeHeader struct {
+	OrderUID string `json:"order_uid" validate:"required"`
+	Sequence int64  `json:"sequence" validate:"required,min=1"`
+}
+
+func (h ChangeHeader) OrderID() string { return h.OrderUID }
+func (h ChangeHeader) Seq() int64      { return h.Sequence }
+
+// OrderPaid — оплата подтверждена
+type OrderPaid struct {
+	ChangeHeader
+	Transaction string `json:"transaction" validate:"required"`
+	PaymentDT   int64  `json:"payment_dt" validate:"required"`
+}
+
+func (e *OrderPaid) EventType() string { return EventOrderPaid }
+
+func (e *OrderPaid) Apply(o *Order) error {
+	if o.Status != StatusCreated {
+		return fmt.Errorf("%w: %s order can't be paid", ErrInvalidTransition, o.Status)
+	}
+	o.Payment.Transaction = e.Transaction
+	o.Payment.PaymentDT = e.PaymentDT
+	o.Status = StatusPaid
+	return nil
+}
+
+// ItemStatusChanged — изменился статус позиции (в том числе её отмена)
+type ItemStatusChanged struct {
+	ChangeHeader
+	ChrtID int `json:"chrt_id" validate:"required"`
+	Status int `json:"status" validate:"required"`
+}
+
+func (e *ItemStatusChanged) EventType() string { return EventItemStatusChanged }
+
+func (e *ItemStatusChanged) Apply(o *Order) error {
+	if o.Status == StatusCancelled {
+		return fmt.Errorf("%w: order is cancelled", ErrInvalidTransition)
+	}
+	found := false
+	for i := range o.Items {
+		if o.Items[i].ChrtID == e.ChrtID {
+			o.Items[i].Status = e.Status
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: chrt_id %d", ErrUnknownItem, e.ChrtID)
+	}
+	return nil
+}
+
+// DeliveryUpdated — исправлен адрес или контакты доставки
+type DeliveryUpdated struct {
+	ChangeHeader
+	Delivery Delivery `json:"delivery" validate:"required"`
+}
+
+func (e *DeliveryUpdated) EventType() string { return EventDeliveryUpdated }
+
+func (e *DeliveryUpdated) Apply(o *Order) error {
+	if o.Status == StatusCancelled {
+		return fmt.Errorf("%w: order is cancelled", ErrInvalidTransition)
+	}
+	o.Delivery = e.Delivery
+	return nil
+}
+
+// OrderCancelled — заказ отменён; после отмены заказ больше не меняется
+type OrderCancelled struct {
+	ChangeHeader
+	Reason string `json:"reason"`
+}
+
+func (e *OrderCancelled) EventType() string { return EventOrderCancelled }
+
+func (e *OrderCancelled) Apply(o *Order) error {
+	if o.Status == StatusCancelled {
+		return fmt.Errorf("%w: order is already cancelled", ErrInvalidTransition)
+	}
+	o.Status = StatusCancelled
+	return nil
+}
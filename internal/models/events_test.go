@@ -0,0 +1,54 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvents_Lifecycle(t *testing.T) {
+	o := testOrder()
+	o.Status = StatusCreated
+	h := ChangeHeader{OrderUID: o.OrderUID}
+
+	require.NoError(t, (&OrderPaid{ChangeHeader: h, Transaction: "t2", PaymentDT: 42}).Apply(o))
+	assert.Equal(t, StatusPaid, o.Status)
+	assert.Equal(t, int64(42), o.Payment.PaymentDT)
+	assert.ErrorIs(t, (&OrderPaid{ChangeHeader: h}).Apply(o), ErrInvalidTransition, "paid twice")
+
+	require.NoError(t, (&ItemStatusChanged{ChangeHeader: h, ChrtID: 9934931, Status: 410}).Apply(o))
+	assert.Equal(t, 410, o.Items[1].Status)
+	assert.ErrorIs(t, (&ItemStatusChanged{ChangeHeader: h, ChrtID: 1}).Apply(o), ErrUnknownItem)
+
+	require.NoError(t, (&DeliveryUpdated{ChangeHeader: h, Delivery: Delivery{City: "Moscow"}}).Apply(o))
+	assert.Equal(t, "Moscow", o.Delivery.City)
+
+	require.NoError(t, (&OrderCancelled{ChangeHeader: h}).Apply(o))
+	assert.Equal(t, StatusCancelled, o.Status)
+
+	// отменённый заказ больше не меняется
+	assert.ErrorIs(t, (&OrderCancelled{ChangeHeader: h}).Apply(o), ErrInvalidTransition)
+	assert.ErrorIs(t, (&DeliveryUpdated{ChangeHeader: h}).Apply(o), ErrInvalidTransition)
+	assert.ErrorIs(t, (&ItemStatusChanged{ChangeHeader: h, ChrtID: 9934930}).Apply(o), ErrInvalidTransition)
+}
+
+func TestNewEvent(t *testing.T) {
+	for _, typ := range []string{EventOrderCreated, EventOrderPaid, EventItemStatusChanged, EventDeliveryUpdated, EventOrderCancelled} {
+		e, ok := NewEvent(typ)
+		require.True(t, ok, typ)
+		assert.Equal(t, typ, e.EventType())
+	}
+	_, ok := NewEvent("order.lost")
+	assert.False(t, ok)
+}
+
+func TestEvents_Validation(t *testing.T) {
+	v := validator.New()
+	assert.Error(t, v.Struct(&OrderPaid{ChangeHeader: ChangeHeader{OrderUID: "1"}, Transaction: "t", PaymentDT: 1}), "no sequence")
+	assert.NoError(t, v.Struct(&OrderCancelled{ChangeHeader: ChangeHeader{OrderUID: "1", Sequence: 1}}))
+	// вложенный заказ проверяется целиком
+	assert.Error(t, v.Struct(&OrderCreated{Order: &Order{OrderUID: "1"}}))
+	assert.Error(t, v.Struct(&OrderCreated{}))
+}
@@ -2,14 +2,15 @@ package models
 
 import "time"
 
+// персональные данные покупателя размечены тегом pii (см. пакет internal/pii)
 type Delivery struct {
-	Name    string `json:"name" validate:"required"`
-	Phone   string `json:"phone" validate:"required,e164"`
-	Zip     string `json:"zip" validate:"required"`
+	Name    string `json:"name" validate:"required" pii:"name"`
+	Phone   string `json:"phone" validate:"required,e164" pii:"phone"`
+	Zip     string `json:"zip" validate:"required" pii:"address"`
 	City    string `json:"city" validate:"required"`
-	Address string `json:"address" validate:"required"`
+	Address string `json:"address" validate:"required" pii:"address"`
 	Region  string `json:"region" validate:"required"`
-	Email   string `json:"email" validate:"required,email"`
+	Email   string `json:"email" validate:"required,email" pii:"email"`
 }
 
 type Payment struct {
@@ -54,4 +55,21 @@ type Order struct {
 	SmID              int       `json:"sm_id" validate:"required"`
 	DateCreated       time.Time `json:"date_created" validate:"required"`
 	OofShard          string    `json:"oof_shard" validate:"required"`
+	// статус меняется событиями жизненного цикла; значение из входящего заказа не сохраняется
+	Status string `json:"status,omitempty"`
+	// номер последнего изменения заказа в БД (change_seq), если заказ прочитан из БД; наружу не отдаётся
+	ChangeSeq int64 `json:"-"`
+}
+
+// Clone — глубокая копия заказа: изменения копии не затрагивают оригинал
+func (o *Order) Clone() *Order {
+	if o == nil {
+		return nil
+	}
+	c := *o
+	if o.Items != nil {
+		c.Items = make([]Items, len(o.Items))
+		copy(c.Items, o.Items)
+	}
+	return &c
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testOrder() *Order {
+	return &Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Delivery:    Delivery{Name: "Test Testov", Phone: "+9720000000"},
+		Payment:     Payment{Transaction: "b563feb7b2b84b6test", Amount: 1817},
+		Items: []Items{
+			{ChrtID: 9934930, Name: "Mascaras", Price: 453},
+			{ChrtID: 9934931, Name: "Lipstick", Price: 120},
+		},
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+	}
+}
+
+func TestOrder_Clone(t *testing.T) {
+	orig := testOrder()
+	c := orig.Clone()
+	assert.Equal(t, orig, c)
+
+	c.Delivery.Name = "changed"
+	c.Payment.Amount = 1
+	c.Items[0].Name = "changed"
+	c.Items = append(c.Items, Items{ChrtID: 1})
+
+	assert.Equal(t, "Test Testov", orig.Delivery.Name)
+	assert.Equal(t, 1817, orig.Payment.Amount)
+	assert.Equal(t, "Mascaras", orig.Items[0].Name)
+	assert.Len(t, orig.Items, 2)
+}
+
+func TestOrder_CloneNil(t *testing.T) {
+	var o *Order
+	assert.Nil(t, o.Clone())
+	assert.Nil(t, (&Order{}).Clone().Items)
+}
+
+func BenchmarkOrder_Clone(b *testing.B) {
+	order := testOrder()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = order.Clone()
+	}
+}
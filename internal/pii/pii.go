@@ -0,0 +1,128 @@
+// Package pii — классы персональных данных и их маскирование: в ответах API по роли вызывающего
+// и в произвольном тексте для логов (RedactText подключается в логгер, см. logger.NewLogger)
+package pii
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+)
+
+// Class — класс персональных данных; поля моделей размечаются тегом pii:"<класс>"
+type Class string
+
+const (
+	Name    Class = "name"
+	Phone   Class = "phone"
+	Email   Class = "email"
+	Address Class = "address"
+)
+
+// MaskMode — степень маскирования персональных данных
+type MaskMode int
+
+const (
+	// данные без изменений
+	MaskNone MaskMode = iota
+	// остаются фрагменты, по которым можно сверить данные с покупателем: +7******1234, t***@example.com
+	MaskPartial
+	// значение целиком заменяется на Redacted
+	MaskFull
+)
+
+// Redacted — замена скрытого значения
+const Redacted = "***"
+
+// field — размеченное поле заказа: путь к нему, ключ в JSON и класс
+type field struct {
+	index []int
+	key   string
+	class Class
+}
+
+// поля заказа с персональными данными, собранные по тегам pii
+var orderFields = collect(reflect.TypeOf(models.Order{}), nil)
+
+// collect обходит вложенные структуры; срезы (Items) не просматриваются — персональных данных в них нет
+func collect(t reflect.Type, prefix []int) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		index := append(append([]int(nil), prefix...), i)
+		if class, ok := f.Tag.Lookup("pii"); ok && f.Type.Kind() == reflect.String {
+			key, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			fields = append(fields, field{index: index, key: key, class: Class(class)})
+			continue
+		}
+		if f.Type.Kind() == reflect.Struct && f.IsExported() {
+			fields = append(fields, collect(f.Type, index)...)
+		}
+	}
+	return fields
+}
+
+// MaskOrder — копия заказа с замаскированными персональными данными; при MaskNone возвращается сам заказ
+func MaskOrder(o *models.Order, mode MaskMode) *models.Order {
+	if o == nil || mode == MaskNone {
+		return o
+	}
+	c := o.Clone()
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range orderFields {
+		fv := v.FieldByIndex(f.index)
+		fv.SetString(Mask(f.class, fv.String(), mode))
+	}
+	return c
+}
+
+// Mask маскирует значение класса class; пустое значение не меняется
+func Mask(class Class, value string, mode MaskMode) string {
+	if value == "" || mode == MaskNone {
+		return value
+	}
+	if mode == MaskFull {
+		return Redacted
+	}
+	switch class {
+	case Phone:
+		return maskPhone(value)
+	case Email:
+		return maskEmail(value)
+	case Name:
+		return maskName(value)
+	}
+	// адрес не показывается и частично: по любой его части легко найти покупателя
+	return Redacted
+}
+
+// +79161231234 → +7******1234: видны код страны и последние 4 цифры
+func maskPhone(s string) string {
+	prefix, digits := "", []rune(s)
+	if rest, ok := strings.CutPrefix(s, "+"); ok {
+		prefix, digits = "+", []rune(rest)
+	}
+	n := len(digits)
+	if n <= 5 {
+		return prefix + strings.Repeat("*", n)
+	}
+	return prefix + string(digits[:1]) + strings.Repeat("*", n-5) + string(digits[n-4:])
+}
+
+// test@gmail.com → t***@gmail.com
+func maskEmail(s string) string {
+	at := strings.LastIndex(s, "@")
+	if at <= 0 {
+		return Redacted
+	}
+	return string([]rune(s[:at])[:1]) + Redacted + s[at:]
+}
+
+// Test Testov → T*** T***
+func maskName(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		words[i] = string([]rune(w)[:1]) + Redacted
+	}
+	return strings.Join(words, " ")
+}
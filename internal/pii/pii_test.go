@@ -0,0 +1,84 @@
+package pii
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMask(t *testing.T) {
+	cases := []struct {
+		class Class
+		value string
+		want  string
+	}{
+		{Phone, "+79161231234", "+7******1234"},
+		{Phone, "+9720000000", "+9*****0000"},
+		{Phone, "12345", "*****"},
+		{Email, "test@gmail.com", "t***@gmail.com"},
+		{Email, "not-an-email", Redacted},
+		{Name, "Test Testov", "T*** T***"},
+		{Name, "Иван", "И***"},
+		{Address, "Ploshad Mira 15", Redacted},
+		{Phone, "", ""},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, Mask(c.class, c.value, MaskPartial), "%s %q", c.class, c.value)
+	}
+	assert.Equal(t, Redacted, Mask(Phone, "+79161231234", MaskFull))
+	assert.Equal(t, "+79161231234", Mask(Phone, "+79161231234", MaskNone))
+}
+
+func TestMaskOrder(t *testing.T) {
+	orig := &models.Order{
+		OrderUID: "b563feb7b2b84b6test",
+		Delivery: models.Delivery{Name: "Test Testov", Phone: "+79161231234", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Items: []models.Items{{ChrtID: 9934930, Name: "Mascaras", Price: 453}},
+	}
+
+	assert.Same(t, orig, MaskOrder(orig, MaskNone))
+
+	partial := MaskOrder(orig, MaskPartial)
+	assert.Equal(t, models.Delivery{Name: "T*** T***", Phone: "+7******1234", Zip: Redacted, City: "Kiryat Mozkin",
+		Address: Redacted, Region: "Kraiot", Email: "t***@gmail.com"}, partial.Delivery)
+	// остальные поля и оригинал не меняются
+	assert.Equal(t, orig.Items, partial.Items)
+	assert.Equal(t, "Test Testov", orig.Delivery.Name)
+
+	full := MaskOrder(orig, MaskFull)
+	assert.Equal(t, Redacted, full.Delivery.Phone)
+	assert.Equal(t, Redacted, full.Delivery.Email)
+	assert.Equal(t, "Kraiot", full.Delivery.Region)
+}
+
+func TestRedactText(t *testing.T) {
+	// битый JSON: маскирование по ключам работает и без разбора
+	raw := `{"order_uid":"b563","delivery":{"name":"Test Testov","phone":"+79161231234","address":"Ploshad Mira 15","email":"test@gmail.com"`
+	got := RedactText(raw)
+	assert.Equal(t, `{"order_uid":"b563","delivery":{"name":"T*** T***","phone":"+7******1234","address":"***","email":"t***@gmail.com"`, got)
+	// повторное маскирование ничего не меняет
+	assert.Equal(t, got, RedactText(got))
+
+	assert.Equal(t, "call +7******1234 or write t***@gmail.com", RedactText("call +79161231234 or write test@gmail.com"))
+	assert.Equal(t, "order saved", RedactText("order saved"))
+}
+
+func BenchmarkRedactText(b *testing.B) {
+	cases := map[string]string{
+		"plain": "order saved to db and cache",
+		"phone": "call +79161231234 about order b563feb7b2b84b6test",
+		"json": `{"order_uid":"b563feb7b2b84b6test","delivery":{"name":"Test Testov","phone":"+9720000000",` +
+			`"address":"Ploshad Mira 15","email":"test@gmail.com"},` + strings.Repeat(`"k":"v",`, 50) + `}`,
+	}
+	for name, s := range cases {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				RedactText(s)
+			}
+		})
+	}
+}
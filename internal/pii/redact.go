@@ -0,0 +1,53 @@
+package pii
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// номер в формате E.164 и адрес почты в произвольном тексте
+	phonePattern = regexp.MustCompile(`\+[1-9]\d{6,14}`)
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// "ключ": "значение" для размеченных полей; находится и в повреждённом JSON
+	keyPattern = regexp.MustCompile(`"(` + strings.Join(keys(), "|") + `)"\s*:\s*"((?:[^"\\]|\\.)*)"`)
+	keyClass   = make(map[string]Class)
+)
+
+// keys — ключи JSON размеченных полей для keyPattern; заодно заполняет keyClass
+func keys() []string {
+	keys := make([]string, 0, len(orderFields))
+	for _, f := range orderFields {
+		if _, ok := keyClass[f.key]; !ok {
+			keyClass[f.key] = f.class
+			keys = append(keys, regexp.QuoteMeta(f.key))
+		}
+	}
+	return keys
+}
+
+// RedactText частично маскирует персональные данные в произвольном тексте, например в теле сообщения
+// для лога: значения размеченных полей JSON (по ключу, поэтому и в битом JSON), номера телефонов и адреса почты.
+// Название товара (items[].name) маскируется тоже: ключ совпадает с именем покупателя.
+// Каждое выражение запускается, только если в тексте есть его обязательный символ: ", + или @,
+// поэтому обычные записи лога проходят без регулярных выражений
+func RedactText(s string) string {
+	if strings.IndexByte(s, '"') >= 0 {
+		s = keyPattern.ReplaceAllStringFunc(s, func(kv string) string {
+			m := keyPattern.FindStringSubmatchIndex(kv)
+			class := keyClass[kv[m[2]:m[3]]]
+			return kv[:m[4]] + Mask(class, kv[m[4]:m[5]], MaskPartial) + kv[m[5]:]
+		})
+	}
+	if strings.IndexByte(s, '+') >= 0 {
+		s = phonePattern.ReplaceAllStringFunc(s, func(p string) string {
+			return Mask(Phone, p, MaskPartial)
+		})
+	}
+	if strings.IndexByte(s, '@') >= 0 {
+		s = emailPattern.ReplaceAllStringFunc(s, func(e string) string {
+			return Mask(Email, e, MaskPartial)
+		})
+	}
+	return s
+}
@@ -0,0 +1,230 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/jackc/pgx/v4"
+)
+
+// BatchResult — итог сохранения одного заказа из пакета; Err относится только к этому заказу
+type BatchResult struct {
+	Result SaveResult
+	Err    error
+}
+
+// заказ, вставка которого отправляется в пакете
+type pendingInsert struct {
+	index int
+	args  []interface{}
+}
+
+// SaveOrders сохраняет пакет заказов в одной транзакции с той же семантикой, что и SaveOrder.
+// Новые заказы вставляются одним пакетом запросов (по одному запросу на заказ); ошибка заказа
+// откатывает только его точку сохранения и попадает в его BatchResult, остальные заказы сохраняются.
+// Ошибка всего пакета (соединение, фиксация транзакции) возвращается отдельно — тогда не сохранено ничего
+func (r *Repository) SaveOrders(ctx context.Context, orders []*models.Order) ([]BatchResult, error) {
+	results := make([]BatchResult, len(orders))
+	hashes := make([][]byte, len(orders))
+	uids := make([]string, 0, len(orders))
+	first := make(map[string]int, len(orders))
+	var repeated []int
+	for i, order := range orders {
+		hashes[i] = orderHash(order)
+		// повтор order_uid внутри пакета сохраняется после него, когда первый уже записан
+		if _, ok := first[order.OrderUID]; ok {
+			repeated = append(repeated, i)
+			continue
+		}
+		first[order.OrderUID] = i
+		uids = append(uids, order.OrderUID)
+	}
+
+	if len(uids) > 0 {
+		if err := r.saveUnique(ctx, orders, hashes, uids, first, results); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, i := range repeated {
+		res, err := r.SaveOrder(ctx, orders[i])
+		results[i] = BatchResult{Result: res, Err: err}
+	}
+	return results, nil
+}
+
+// saveUnique сохраняет заказы с различными order_uid (индексы в first)
+func (r *Repository) saveUnique(ctx context.Context, orders []*models.Order, hashes [][]byte, uids []string, first map[string]int, results []BatchResult) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// блокировки берутся в одном порядке, чтобы параллельные пакеты не ждали друг друга по кругу
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext(uid))
+	FROM (SELECT DISTINCT uid FROM unnest($1::text[]) AS uid ORDER BY uid) AS s`, uids); err != nil {
+		return fmt.Errorf("lock orders failed: %w", err)
+	}
+
+	type existingOrder struct {
+		hash                  []byte
+		deliveryID, paymentID int
+	}
+	existing := make(map[string]existingOrder)
+	rows, err := tx.Query(ctx, `SELECT order_uid, payload_hash, delivery_id, payment_id FROM orders WHERE order_uid = ANY($1)`, uids)
+	if err != nil {
+		return fmt.Errorf("get existing orders failed: %w", err)
+	}
+	for rows.Next() {
+		var uid string
+		var e existingOrder
+		if err := rows.Scan(&uid, &e.hash, &e.deliveryID, &e.paymentID); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan existing order failed: %w", err)
+		}
+		existing[uid] = e
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("get existing orders failed: %w", err)
+	}
+
+	var inserts []pendingInsert
+	for _, uid := range uids {
+		i := first[uid]
+		order, hash := orders[i], hashes[i]
+		e, ok := existing[uid]
+		if !ok {
+			order.Status = models.StatusCreated
+			args, err := insertOrderArgs(order, hash)
+			if err != nil {
+				results[i].Err = err
+				continue
+			}
+			inserts = append(inserts, pendingInsert{index: i, args: args})
+			continue
+		}
+		stored := e.hash
+		if !isCurrentHash(stored) {
+			err := inSavepoint(ctx, tx, "hash", func() error {
+				var err error
+				stored, err = currentHash(ctx, tx, uid, stored)
+				return err
+			})
+			if err != nil {
+				if !isStatementError(err) {
+					return err
+				}
+				results[i].Err = err
+				continue
+			}
+		}
+		if res := r.compareHash(stored, hash); res != SaveUpdated {
+			results[i].Result = res
+			continue
+		}
+		// изменения существующих заказов редки, они сохраняются по одному
+		err := inSavepoint(ctx, tx, "upd", func() error {
+			if r.onConflict == ConflictVersion {
+				if err := archiveOrder(ctx, tx, uid); err != nil {
+					return err
+				}
+			}
+			if err := updateOrder(ctx, tx, order, hash, e.deliveryID, e.paymentID); err != nil {
+				return err
+			}
+			return insertOutbox(ctx, tx, models.EventOrderUpdated, order)
+		})
+		if err != nil {
+			if !isStatementError(err) {
+				return err
+			}
+			results[i].Err = err
+			continue
+		}
+		results[i].Result = SaveUpdated
+	}
+
+	if err := insertBatch(ctx, tx, inserts, results); err != nil {
+		return err
+	}
+
+	// Commit
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+	return nil
+}
+
+// insertBatch вставляет заказы пакетами запросов. Если заказ отклонён сервером, транзакция
+// откатывается к его точке сохранения, а оставшиеся заказы отправляются следующим пакетом
+func insertBatch(ctx context.Context, tx pgx.Tx, inserts []pendingInsert, results []BatchResult) error {
+	for len(inserts) > 0 {
+		batch := &pgx.Batch{}
+		for n, ins := range inserts {
+			batch.Queue(fmt.Sprintf("SAVEPOINT ins_%d", n))
+			batch.Queue(insertOrderSQL, ins.args...)
+			batch.Queue(fmt.Sprintf("RELEASE SAVEPOINT ins_%d", n))
+		}
+		br := tx.SendBatch(ctx, batch)
+		failed, failErr := -1, error(nil)
+		for n := range inserts {
+			if _, err := br.Exec(); err != nil {
+				return closeBatch(br, fmt.Errorf("savepoint failed: %w", err))
+			}
+			if _, err := br.Exec(); err != nil {
+				failed, failErr = n, err
+				break
+			}
+			if _, err := br.Exec(); err != nil {
+				return closeBatch(br, fmt.Errorf("release savepoint failed: %w", err))
+			}
+			results[inserts[n].index].Result = SaveInserted
+		}
+		// после ошибки сервер пропускает остаток пакета, поэтому его результаты не читаем
+		_ = br.Close()
+		if failed < 0 {
+			return nil
+		}
+		if !isStatementError(failErr) {
+			return fmt.Errorf("Insert order failed: %w", failErr)
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf("ROLLBACK TO SAVEPOINT ins_%d", failed)); err != nil {
+			return fmt.Errorf("rollback to savepoint failed: %w", err)
+		}
+		results[inserts[failed].index].Err = fmt.Errorf("Insert order failed: %w", failErr)
+		inserts = inserts[failed+1:]
+	}
+	return nil
+}
+
+// inSavepoint выполняет fn внутри точки сохранения; при ошибке изменения fn откатываются
+func inSavepoint(ctx context.Context, tx pgx.Tx, name string, fn func() error) error {
+	if _, err := tx.Exec(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("savepoint failed: %w", err)
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := tx.Exec(ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			return fmt.Errorf("rollback to savepoint failed: %w", rbErr)
+		}
+		return err
+	}
+	if _, err := tx.Exec(ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("release savepoint failed: %w", err)
+	}
+	return nil
+}
+
+// isStatementError — ошибка касается только запроса (например, нарушено ограничение),
+// и транзакцию можно продолжить после отката к точке сохранения
+func isStatementError(err error) bool {
+	return !IsRetryable(err) && !errors.Is(err, context.Canceled)
+}
+
+func closeBatch(br pgx.BatchResults, err error) error {
+	_ = br.Close()
+	return err
+}
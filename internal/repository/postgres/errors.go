@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+)
+
+// IsRetryable сообщает, может ли повтор операции завершиться успешно.
+// Ошибки сервера повторяются только для временных состояний: обрыв соединения,
+// конфликт сериализации или взаимоблокировка, нехватка ресурсов, перезапуск сервера.
+// Нарушения ограничений (например, уникальности) и ошибки в данных повторять бессмысленно
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		code := pgErr.Code
+		return pgerrcode.IsConnectionException(code) ||
+			pgerrcode.IsTransactionRollback(code) ||
+			pgerrcode.IsInsufficientResources(code) ||
+			(pgerrcode.IsOperatorIntervention(code) && code != pgerrcode.QueryCanceled) ||
+			code == pgerrcode.LockNotAvailable
+	}
+	// без кода сервера повторяем только сетевые сбои: обрыв или закрытие соединения, тайм-аут.
+	// Остальное — ошибки кодирования, сканирования, закрытый пул — при повторе не исправится
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		pgconn.Timeout(err) ||
+		pgconn.SafeToRetry(err)
+}
@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	pgErr := func(code string) error {
+		return fmt.Errorf("insert order failed: %w", &pgconn.PgError{Code: code})
+	}
+	cases := map[string]struct {
+		err  error
+		want bool
+	}{
+		"unique violation":      {pgErr(pgerrcode.UniqueViolation), false},
+		"not null violation":    {pgErr(pgerrcode.NotNullViolation), false},
+		"string too long":       {pgErr(pgerrcode.StringDataRightTruncationDataException), false},
+		"undefined table":       {pgErr(pgerrcode.UndefinedTable), false},
+		"query canceled":        {pgErr(pgerrcode.QueryCanceled), false},
+		"serialization failure": {pgErr(pgerrcode.SerializationFailure), true},
+		"deadlock":              {pgErr(pgerrcode.DeadlockDetected), true},
+		"connection failure":    {pgErr(pgerrcode.ConnectionFailure), true},
+		"too many connections":  {pgErr(pgerrcode.TooManyConnections), true},
+		"admin shutdown":        {pgErr(pgerrcode.AdminShutdown), true},
+		"lock not available":    {pgErr(pgerrcode.LockNotAvailable), true},
+		"context canceled":      {fmt.Errorf("begin tx failed: %w", context.Canceled), false},
+		"deadline exceeded":     {fmt.Errorf("query failed: %w", context.DeadlineExceeded), true},
+		"connection reset": {
+			fmt.Errorf("query failed: %w", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}), true,
+		},
+		"unexpected eof":  {fmt.Errorf("receive message failed: %w", io.ErrUnexpectedEOF), true},
+		"eof":             {fmt.Errorf("receive message failed: %w", io.EOF), true},
+		"not found":       {fmt.Errorf("get order failed: %w", ErrOrderNotFound), false},
+		"marshal failure": {fmt.Errorf("marshal order failed: %w", &json.UnsupportedValueError{Str: "NaN"}), false},
+		"plain error":     {errors.New("scan order failed: unexpected column"), false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, IsRetryable(tc.err))
+		})
+	}
+}
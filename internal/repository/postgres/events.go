@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/jackc/pgx/v4"
+)
+
+// EventResult — итог применения события жизненного цикла к сохранённому заказу
+type EventResult int
+
+const (
+	// событие применено
+	EventApplied EventResult = iota + 1
+	// событие с таким номером уже применено, ничего не изменилось
+	EventDuplicate
+	// заказа с таким order_uid нет
+	EventUnknownOrder
+	// пропущены предыдущие события заказа
+	EventOutOfOrder
+	// событие недопустимо для текущего состояния заказа
+	EventRejected
+)
+
+func (r EventResult) String() string {
+	switch r {
+	case EventApplied:
+		return "applied"
+	case EventDuplicate:
+		return "duplicate"
+	case EventUnknownOrder:
+		return "unknown_order"
+	case EventOutOfOrder:
+		return "out_of_order"
+	case EventRejected:
+		return "rejected"
+	}
+	return "unknown"
+}
+
+// EventOutcome — итог ApplyEvent: Order — заказ после применения (EventApplied),
+// Reason — почему событие отклонено (EventRejected, EventOutOfOrder)
+type EventOutcome struct {
+	Result EventResult
+	Order  *models.Order
+	Reason error
+}
+
+// ApplyEvent применяет событие к сохранённому заказу. События одного заказа применяются строго по порядку
+// номеров: повтор уже применённого события ничего не меняет, событие после пропуска не применяется
+func (r *Repository) ApplyEvent(ctx context.Context, change models.Change) (EventOutcome, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return EventOutcome{}, fmt.Errorf("begin tx failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var seq int64
+	var deliveryID, paymentID int
+	err = tx.QueryRow(ctx, `SELECT event_seq, delivery_id, payment_id FROM orders WHERE order_uid = $1 FOR UPDATE`,
+		change.OrderID()).Scan(&seq, &deliveryID, &paymentID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return EventOutcome{Result: EventUnknownOrder}, nil
+	case err != nil:
+		return EventOutcome{}, fmt.Errorf("lock order failed: %w", err)
+	case change.Seq() <= seq:
+		return EventOutcome{Result: EventDuplicate}, nil
+	case change.Seq() > seq+1:
+		return EventOutcome{
+			Result: EventOutOfOrder,
+			Reason: fmt.Errorf("event %d arrived before %d", change.Seq(), seq+1),
+		}, nil
+	}
+
+	order, err := getOrder(ctx, tx, change.OrderID())
+	if err != nil {
+		return EventOutcome{}, err
+	}
+	if err := change.Apply(order); err != nil {
+		if errors.Is(err, models.ErrInvalidTransition) || errors.Is(err, models.ErrUnknownItem) {
+			return EventOutcome{Result: EventRejected, Reason: err}, nil
+		}
+		return EventOutcome{}, err
+	}
+	if err := writeChange(ctx, tx, change, order, deliveryID, paymentID); err != nil {
+		return EventOutcome{}, err
+	}
+	_, err = tx.Exec(ctx, `UPDATE orders SET status = $2, event_seq = $3 WHERE order_uid = $1`,
+		order.OrderUID, order.Status, change.Seq())
+	if err != nil {
+		return EventOutcome{}, fmt.Errorf("update order status failed: %w", err)
+	}
+	if err := insertOutbox(ctx, tx, change.EventType(), order); err != nil {
+		return EventOutcome{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return EventOutcome{}, fmt.Errorf("commit failed: %w", err)
+	}
+	return EventOutcome{Result: EventApplied, Order: order}, nil
+}
+
+// writeChange сохраняет части заказа, изменённые событием; статус и номер события пишет ApplyEvent
+func writeChange(ctx context.Context, tx pgx.Tx, change models.Change, order *models.Order, deliveryID, paymentID int) error {
+	var err error
+	switch e := change.(type) {
+	case *models.OrderPaid:
+		_, err = tx.Exec(ctx, `UPDATE payment SET transaction = $2, payment_dt = $3 WHERE id = $1`,
+			paymentID, order.Payment.Transaction, order.Payment.PaymentDT)
+	case *models.ItemStatusChanged:
+		_, err = tx.Exec(ctx, `UPDATE items SET status = $3 WHERE order_uid = $1 AND chrt_id = $2`,
+			order.OrderUID, e.ChrtID, e.Status)
+	case *models.DeliveryUpdated:
+		_, err = tx.Exec(ctx, `UPDATE delivery SET name = $2, phone = $3, zip = $4, city = $5, address = $6, region = $7, email = $8
+		WHERE id = $1`,
+			deliveryID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City, order.Delivery.Address,
+			order.Delivery.Region, order.Delivery.Email)
+	case *models.OrderCancelled:
+	default:
+		return fmt.Errorf("unsupported event %s", change.EventType())
+	}
+	if err != nil {
+		return fmt.Errorf("apply %s failed: %w", change.EventType(), err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/jackc/pgx/v4"
+)
+
+// hashVersion — версия канонического представления заказа, хранится первым байтом payload_hash.
+// Меняется вместе с составом полей в orderHash; хэши прежних версий пересчитываются по данным из БД
+const hashVersion byte = 2
+
+// orderHash — отпечаток содержимого заказа для распознавания повторных сообщений.
+// Поля перечислены явно и не зависят от JSON-представления модели. Поля, которые меняют события, —
+// статусы заказа и позиций, доставка, транзакция и время оплаты — не входят: иначе повторно доставленное
+// сообщение с заказом после события не совпало бы с хэшем, пересчитанным по БД. Время берётся так, как его хранит
+// столбец TIMESTAMP: по часам без часового пояса с точностью до микросекунды
+func orderHash(order *models.Order) []byte {
+	w := canonicalWriter{h: sha256.New()}
+	w.str(order.OrderUID)
+	w.str(order.TrackNumber)
+	w.str(order.Entry)
+	w.str(order.Locale)
+	w.str(order.InternalSignature)
+	w.str(order.CustomerID)
+	w.str(order.DeliveryService)
+	w.str(order.ShardKey)
+	w.int(int64(order.SmID))
+	w.str(order.DateCreated.Round(time.Microsecond).Format("2006-01-02T15:04:05.999999"))
+	w.str(order.OofShard)
+
+	p := order.Payment
+	w.str(p.RequestID)
+	w.str(p.Currency)
+	w.str(p.Provider)
+	w.int(int64(p.Amount))
+	w.str(p.Bank)
+	w.int(int64(p.DeliveryCost))
+	w.int(int64(p.GoodsTotal))
+	w.int(int64(p.CustomFee))
+
+	w.int(int64(len(order.Items)))
+	for _, it := range order.Items {
+		w.int(int64(it.ChrtID))
+		w.str(it.TrackNumber)
+		w.int(int64(it.Price))
+		w.str(it.RID)
+		w.str(it.Name)
+		w.int(int64(it.Sale))
+		w.str(it.Size)
+		w.int(int64(it.TotalPrice))
+		w.int(int64(it.NmID))
+		w.str(it.Brand)
+	}
+	return w.h.Sum([]byte{hashVersion})
+}
+
+// canonicalWriter пишет значения в хэш с длиной перед строками, чтобы соседние поля не склеивались
+type canonicalWriter struct {
+	h   hash.Hash
+	buf [8]byte
+}
+
+func (w *canonicalWriter) int(v int64) {
+	binary.BigEndian.PutUint64(w.buf[:], uint64(v))
+	w.h.Write(w.buf[:])
+}
+
+func (w *canonicalWriter) str(s string) {
+	w.int(int64(len(s)))
+	io.WriteString(w.h, s)
+}
+
+// currentHash — хэш сохранённого заказа текущей версии. У заказов, сохранённых до появления
+// payload_hash (NULL) или с хэшем прежней версии, он вычисляется по данным из БД и записывается
+func currentHash(ctx context.Context, tx pgx.Tx, uid string, stored []byte) ([]byte, error) {
+	if isCurrentHash(stored) {
+		return stored, nil
+	}
+	order, err := getOrder(ctx, tx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("load order for hash failed: %w", err)
+	}
+	hash := orderHash(order)
+	if _, err := tx.Exec(ctx, `UPDATE orders SET payload_hash = $2 WHERE order_uid = $1`, uid, hash); err != nil {
+		return nil, fmt.Errorf("update order hash failed: %w", err)
+	}
+	return hash, nil
+}
+
+// isCurrentHash — хэш посчитан текущей версией orderHash
+func isCurrentHash(stored []byte) bool {
+	return len(stored) == sha256.Size+1 && stored[0] == hashVersion
+}
+
+// compareHash — итог сохранения заказа, order_uid которого уже есть в БД
+func (r *Repository) compareHash(stored, hash []byte) SaveResult {
+	switch {
+	case bytes.Equal(stored, hash):
+		return SaveUnchanged
+	case r.onConflict == ConflictReject:
+		return SaveConflict
+	}
+	return SaveUpdated
+}
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+// канал, в который триггеры публикуют UID изменённых заказов и номер изменения — order_uid:change_seq
+// (migrations/0002_order_notify, migrations/0008_notify_change_seq)
+const OrderChangedChannel = "order_changed"
+
+// notifyConn — часть *pgx.Conn, нужная слушателю
+type notifyConn interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+	Close(ctx context.Context) error
+}
+
+// OrderListener — подписка на изменения заказов через LISTEN/NOTIFY.
+// Держит отдельное соединение вне пула и переподключается при его потере
+type OrderListener struct {
+	connect    func(ctx context.Context) (notifyConn, error)
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	log        *zap.SugaredLogger
+}
+
+// конструктор OrderListener; connString — строка подключения к той же БД, что и у пула
+func NewOrderListener(connString string, log *zap.SugaredLogger) *OrderListener {
+	return &OrderListener{
+		connect: func(ctx context.Context) (notifyConn, error) {
+			conn, err := pgx.Connect(ctx, connString)
+			if err != nil {
+				return nil, err
+			}
+			return conn, nil
+		},
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+		log:        log,
+	}
+}
+
+// Listen вызывает fn с UID и номером изменения (change_seq) каждого изменённого заказа до отмены контекста;
+// номер 0 — неизвестен. После переподключения fn получает пустой UID: уведомления за время разрыва потеряны
+func (l *OrderListener) Listen(ctx context.Context, fn func(orderUID string, changeSeq int64)) {
+	backoff := l.minBackoff
+	resync := false
+	for {
+		subscribed, err := l.listen(ctx, fn, resync)
+		if ctx.Err() != nil {
+			l.log.Info("order change listener stopped")
+			return
+		}
+		if subscribed {
+			resync = true
+			backoff = l.minBackoff
+		}
+		l.log.Warnw("order change listener disconnected, reconnecting", "err", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			l.log.Info("order change listener stopped")
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, l.maxBackoff)
+	}
+}
+
+// одна сессия LISTEN; возвращает true, если подписка успела оформиться
+func (l *OrderListener) listen(ctx context.Context, fn func(orderUID string, changeSeq int64), resync bool) (bool, error) {
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = conn.Close(closeCtx)
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+OrderChangedChannel); err != nil {
+		return false, err
+	}
+	l.log.Infow("listening for order changes", "channel", OrderChangedChannel)
+	if resync {
+		fn("", 0)
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+		if n.Channel == OrderChangedChannel {
+			fn(parseOrderChanged(n.Payload))
+		}
+	}
+}
+
+// parseOrderChanged разбирает payload order_uid:change_seq; у уведомлений без номера
+// (триггеры до migrations/0008_notify_change_seq) весь payload — UID, номер 0
+func parseOrderChanged(payload string) (string, int64) {
+	i := strings.LastIndexByte(payload, ':')
+	if i < 0 {
+		return payload, 0
+	}
+	seq, err := strconv.ParseInt(payload[i+1:], 10, 64)
+	if err != nil || seq <= 0 {
+		return payload, 0
+	}
+	return payload[:i], seq
+}
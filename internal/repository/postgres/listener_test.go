@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeConn отдаёт заранее заданные уведомления, а затем обрывает соединение
+type fakeConn struct {
+	notifications []*pgconn.Notification
+}
+
+func (c *fakeConn) Exec(_ context.Context, sql string, _ ...interface{}) (pgconn.CommandTag, error) {
+	if sql != "LISTEN "+OrderChangedChannel {
+		return nil, errors.New("unexpected query")
+	}
+	return nil, nil
+}
+
+func (c *fakeConn) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	if len(c.notifications) == 0 {
+		return nil, errors.New("connection lost")
+	}
+	n := c.notifications[0]
+	c.notifications = c.notifications[1:]
+	return n, nil
+}
+
+func (c *fakeConn) Close(context.Context) error { return nil }
+
+func TestOrderListener_ReconnectsAndResyncs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sessions := [][]*pgconn.Notification{
+		{{Channel: OrderChangedChannel, Payload: "a:5"}, {Channel: "other", Payload: "x"}},
+		nil, // ошибка подключения
+		{{Channel: OrderChangedChannel, Payload: "b"}},
+	}
+	var attempt int
+	l := &OrderListener{
+		connect: func(context.Context) (notifyConn, error) {
+			defer func() { attempt++ }()
+			switch {
+			case attempt >= len(sessions):
+				cancel()
+				return nil, context.Canceled
+			case sessions[attempt] == nil:
+				return nil, errors.New("connection refused")
+			}
+			return &fakeConn{notifications: sessions[attempt]}, nil
+		},
+		minBackoff: time.Millisecond,
+		maxBackoff: 2 * time.Millisecond,
+		log:        zap.NewNop().Sugar(),
+	}
+
+	var mu sync.Mutex
+	var got []string
+	l.Listen(ctx, func(orderUID string, changeSeq int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, fmt.Sprintf("%s@%d", orderUID, changeSeq))
+	})
+
+	// после переподключения приходит пустой UID — сигнал пересинхронизации
+	assert.Equal(t, []string{"a@5", "@0", "b@0"}, got)
+}
+
+func TestParseOrderChanged(t *testing.T) {
+	cases := map[string]struct {
+		uid string
+		seq int64
+	}{
+		"b563feb7b2b84b6test:42": {"b563feb7b2b84b6test", 42},
+		"b563feb7b2b84b6test":    {"b563feb7b2b84b6test", 0},
+		"a:b:7":                  {"a:b", 7},
+		"a:b":                    {"a:b", 0},
+		"a:-1":                   {"a:-1", 0},
+	}
+	for payload, want := range cases {
+		uid, seq := parseOrderChanged(payload)
+		assert.Equal(t, want.uid, uid, payload)
+		assert.Equal(t, want.seq, seq, payload)
+	}
+}
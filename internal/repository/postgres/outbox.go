@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/jackc/pgx/v4"
+)
+
+// OutboxMessage — событие о сохранённом заказе, ожидающее отправки; Payload — заказ после изменения в JSON
+type OutboxMessage struct {
+	ID        int64
+	OrderUID  string
+	EventType string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// insertOutbox записывает событие о заказе в outbox в транзакции, изменившей заказ
+func insertOutbox(ctx context.Context, tx pgx.Tx, eventType string, order *models.Order) error {
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("encode outbox payload failed: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO outbox (order_uid, event_type, payload) VALUES ($1, $2, $3)`,
+		order.OrderUID, eventType, payload); err != nil {
+		return fmt.Errorf("insert outbox failed: %w", err)
+	}
+	return nil
+}
+
+// ClaimOutbox забирает до limit неотправленных событий в порядке записи на время ttl и возвращает их.
+// Запрос выполняется отдельной короткой транзакцией: на время отправки в Kafka строки не блокируются,
+// а другие реплики пропускают забранные события, пока не истечёт ttl
+func (r *Repository) ClaimOutbox(ctx context.Context, limit int, ttl time.Duration) ([]OutboxMessage, error) {
+	rows, err := r.db.Query(ctx, `UPDATE outbox SET claimed_until = now() + $2::interval
+	WHERE id IN (
+		SELECT id FROM outbox
+		WHERE sent_at IS NULL AND (claimed_until IS NULL OR claimed_until < now())
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED)
+	RETURNING id, order_uid, event_type, payload, created_at`, limit, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("claim outbox failed: %w", err)
+	}
+	defer rows.Close()
+
+	var msgs []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.OrderUID, &m.EventType, &m.Payload, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan outbox failed: %w", err)
+		}
+		msgs = append(msgs, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("claim outbox failed: %w", err)
+	}
+	// RETURNING не сохраняет порядок подзапроса
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID < msgs[j].ID })
+	return msgs, nil
+}
+
+// MarkOutboxSent отмечает события отправленными или, при deleteSent, удаляет их
+func (r *Repository) MarkOutboxSent(ctx context.Context, ids []int64, deleteSent bool) error {
+	query := `UPDATE outbox SET sent_at = now() WHERE id = ANY($1)`
+	if deleteSent {
+		query = `DELETE FROM outbox WHERE id = ANY($1)`
+	}
+	if _, err := r.db.Exec(ctx, query, ids); err != nil {
+		return fmt.Errorf("mark outbox sent failed: %w", err)
+	}
+	return nil
+}
+
+// ReleaseOutbox возвращает забранные события, которые не удалось отправить, не дожидаясь истечения ttl
+func (r *Repository) ReleaseOutbox(ctx context.Context, ids []int64) error {
+	if _, err := r.db.Exec(ctx, `UPDATE outbox SET claimed_until = NULL WHERE id = ANY($1) AND sent_at IS NULL`, ids); err != nil {
+		return fmt.Errorf("release outbox failed: %w", err)
+	}
+	return nil
+}
+
+// DeleteSentOutbox удаляет события, отправленные раньше before
+func (r *Repository) DeleteSentOutbox(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM outbox WHERE sent_at IS NOT NULL AND sent_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete sent outbox failed: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -2,8 +2,11 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/MikhaylovMaks/wb_techl0/internal/models"
 	"github.com/jackc/pgx/v4"
@@ -11,63 +14,255 @@ import (
 )
 
 type OrderRepository interface {
-	SaveOrder(ctx context.Context, order *models.Order) error
+	SaveOrder(ctx context.Context, order *models.Order) (SaveResult, error)
+	SaveOrders(ctx context.Context, orders []*models.Order) ([]BatchResult, error)
 	GetOrderByUID(ctx context.Context, uid string) (*models.Order, error)
 	GetAllOrderUIDs(ctx context.Context) ([]string, error)
+	StreamOrders(ctx context.Context, filter OrderFilter, pageSize int, fn func(page []StreamedOrder) error) error
+	ChangeWatermark(ctx context.Context) (int64, error)
+	DeletedSince(ctx context.Context, watermark int64) ([]string, error)
+	ApplyEvent(ctx context.Context, change models.Change) (EventOutcome, error)
 }
 
 type Repository struct {
-	db *pgxpool.Pool
+	db         dbPool
+	onConflict ConflictPolicy
 }
 
-func NewRepository(db *pgxpool.Pool) *Repository {
-	return &Repository{db: db}
+// конструктор Repository; каждый запрос к БД записывается спаном трассировки
+func NewRepository(db *pgxpool.Pool, onConflict ConflictPolicy) *Repository {
+	return &Repository{db: tracedPool{pool: db}, onConflict: onConflict}
 }
 
 var ErrOrderNotFound = errors.New("order not found")
 
-func (r *Repository) SaveOrder(ctx context.Context, order *models.Order) error {
+// ConflictPolicy — что делать, если заказ с тем же order_uid уже сохранён с другим содержимым
+type ConflictPolicy string
+
+const (
+	// не менять сохранённый заказ и вернуть SaveConflict
+	ConflictReject ConflictPolicy = "reject"
+	// перезаписать заказ новым содержимым
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// перезаписать, сохранив прежнее содержимое в order_versions
+	ConflictVersion ConflictPolicy = "version"
+)
+
+// ParseConflictPolicy проверяет название политики из настроек
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case ConflictReject, ConflictOverwrite, ConflictVersion:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q", s)
+}
+
+// SaveResult — итог сохранения заказа
+type SaveResult int
+
+const (
+	// заказ сохранён впервые
+	SaveInserted SaveResult = iota + 1
+	// такой же заказ уже сохранён, ничего не изменилось
+	SaveUnchanged
+	// сохранённый заказ заменён новым содержимым
+	SaveUpdated
+	// заказ с другим содержимым уже сохранён и политика запрещает его менять
+	SaveConflict
+)
+
+func (r SaveResult) String() string {
+	switch r {
+	case SaveInserted:
+		return "inserted"
+	case SaveUnchanged:
+		return "unchanged"
+	case SaveUpdated:
+		return "updated"
+	case SaveConflict:
+		return "conflict"
+	}
+	return "unknown"
+}
+
+// SaveOrder сохраняет заказ идемпотентно: повтор того же сообщения ничего не меняет,
+// а изменённый заказ с известным order_uid обрабатывается по политике конфликтов.
+// Вставка и перезапись заказа записывают событие в outbox в той же транзакции.
+// Статус заказа ведёт сервис, а не отправитель: после вставки или перезаписи order.Status —
+// статус сохранённого заказа (created для нового, прежний — для перезаписанного)
+func (r *Repository) SaveOrder(ctx context.Context, order *models.Order) (SaveResult, error) {
+	hash := orderHash(order)
+
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("begin tx failed: %w", err)
+		return 0, fmt.Errorf("begin tx failed: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	// 1. Delivery
-	var deliveryID int
-	err = tx.QueryRow(ctx, `INSERT INTO delivery (name, phone, zip, city, address, region, email)
-	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
-		order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City, order.Delivery.Address, order.Delivery.Region,
-		order.Delivery.Email).Scan(&deliveryID)
+	// одновременные сохранения одного заказа выполняются по очереди
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, order.OrderUID); err != nil {
+		return 0, fmt.Errorf("lock order failed: %w", err)
+	}
+
+	var existingHash []byte
+	var deliveryID, paymentID int
+	err = tx.QueryRow(ctx, `SELECT payload_hash, delivery_id, payment_id FROM orders WHERE order_uid = $1`,
+		order.OrderUID).Scan(&existingHash, &deliveryID, &paymentID)
+	var result SaveResult
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		order.Status = models.StatusCreated
+		if err := insertOrder(ctx, tx, order, hash); err != nil {
+			return 0, err
+		}
+		result = SaveInserted
+	case err != nil:
+		return 0, fmt.Errorf("get existing order failed: %w", err)
+	default:
+		existingHash, err = currentHash(ctx, tx, order.OrderUID, existingHash)
+		if err != nil {
+			return 0, err
+		}
+		result = r.compareHash(existingHash, hash)
+	}
+
+	if result == SaveUpdated {
+		if r.onConflict == ConflictVersion {
+			if err := archiveOrder(ctx, tx, order.OrderUID); err != nil {
+				return 0, err
+			}
+		}
+		if err := updateOrder(ctx, tx, order, hash, deliveryID, paymentID); err != nil {
+			return 0, err
+		}
+		if err := insertOutbox(ctx, tx, models.EventOrderUpdated, order); err != nil {
+			return 0, err
+		}
+	}
+
+	// Commit; и без изменений заказа — currentHash мог записать хэш
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit failed: %w", err)
+	}
+	return result, nil
+}
+
+// вставка заказа со всеми связанными строками и событием order.created в outbox одним запросом;
+// его выполняет SaveOrder и пакетами отправляет SaveOrders
+const insertOrderSQL = `WITH d AS (
+	INSERT INTO delivery (name, phone, zip, city, address, region, email)
+	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+), p AS (
+	INSERT INTO payment (transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
+	VALUES ($8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING id
+), o AS (
+	INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service,
+		shardkey, sm_id, date_created, oof_shard, delivery_id, payment_id, payload_hash)
+	SELECT $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, d.id, p.id, $29 FROM d, p
+	RETURNING order_uid
+), ob AS (
+	INSERT INTO outbox (order_uid, event_type, payload)
+	SELECT o.order_uid, '` + models.EventOrderCreated + `', $41 FROM o
+)
+INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
+SELECT o.order_uid, i.chrt_id, i.track_number, i.price, i.rid, i.name, i.sale, i.size, i.total_price, i.nm_id, i.brand, i.status
+FROM o, unnest($30::int[], $31::text[], $32::int[], $33::text[], $34::text[], $35::int[], $36::text[], $37::int[], $38::int[], $39::text[], $40::int[])
+	AS i(chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)`
+
+// insertOrder вставляет новый заказ запросом insertOrderSQL
+func insertOrder(ctx context.Context, tx pgx.Tx, order *models.Order, hash []byte) error {
+	args, err := insertOrderArgs(order, hash)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, insertOrderSQL, args...); err != nil {
+		return fmt.Errorf("Insert order failed: %w", err)
+	}
+	return nil
+}
+
+// insertOrderArgs — параметры insertOrderSQL; позиции передаются массивами по столбцам
+func insertOrderArgs(order *models.Order, hash []byte) ([]interface{}, error) {
+	payload, err := json.Marshal(order)
 	if err != nil {
-		return fmt.Errorf("insert delivery failed: %w", err)
+		return nil, fmt.Errorf("encode outbox payload failed: %w", err)
 	}
+	n := len(order.Items)
+	chrtIDs, prices, sales, totals, nmIDs, statuses := make([]int, n), make([]int, n), make([]int, n), make([]int, n), make([]int, n), make([]int, n)
+	tracks, rids, names, sizes, brands := make([]string, n), make([]string, n), make([]string, n), make([]string, n), make([]string, n)
+	for i, item := range order.Items {
+		chrtIDs[i], tracks[i], prices[i], rids[i], names[i] = item.ChrtID, item.TrackNumber, item.Price, item.RID, item.Name
+		sales[i], sizes[i], totals[i], nmIDs[i], brands[i], statuses[i] = item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status
+	}
+	return []interface{}{
+		order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City, order.Delivery.Address,
+		order.Delivery.Region, order.Delivery.Email,
+		order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency, order.Payment.Provider, order.Payment.Amount,
+		order.Payment.PaymentDT, order.Payment.Bank, order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee,
+		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature, order.CustomerID,
+		order.DeliveryService, order.ShardKey, order.SmID, order.DateCreated, order.OofShard, hash,
+		chrtIDs, tracks, prices, rids, names, sales, sizes, totals, nmIDs, brands, statuses, payload,
+	}, nil
+}
 
-	// 2. Payment
-	var paymentID int
-	err = tx.QueryRow(ctx, `INSERT INTO payment (transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
-	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING id`,
-		order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency, order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDT, order.Payment.Bank,
-		order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee).Scan(&paymentID)
+// updateOrder перезаписывает заказ на месте: строки delivery и payment переиспользуются, позиции заменяются.
+// Статус и номер последнего события не меняются; order.Status получает статус из БД
+func updateOrder(ctx context.Context, tx pgx.Tx, order *models.Order, hash []byte, deliveryID, paymentID int) error {
+	_, err := tx.Exec(ctx, `UPDATE delivery SET name = $2, phone = $3, zip = $4, city = $5, address = $6, region = $7, email = $8
+	WHERE id = $1`,
+		deliveryID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City, order.Delivery.Address,
+		order.Delivery.Region, order.Delivery.Email)
 	if err != nil {
-		return fmt.Errorf("insert payment failed: %w", err)
+		return fmt.Errorf("update delivery failed: %w", err)
 	}
 
-	// 3. Order
-	_, err = tx.Exec(ctx, `INSERT INTO orders (order_uid, track_number, entry, locale,
-	internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created,
-	oof_shard, delivery_id, payment_id)
-	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)`, order.OrderUID, order.TrackNumber, order.Entry, order.Locale,
-		order.InternalSignature, order.CustomerID, order.DeliveryService,
-		order.ShardKey, order.SmID, order.DateCreated, order.OofShard,
-		deliveryID, paymentID)
+	_, err = tx.Exec(ctx, `UPDATE payment SET transaction = $2, request_id = $3, currency = $4, provider = $5, amount = $6,
+	payment_dt = $7, bank = $8, delivery_cost = $9, goods_total = $10, custom_fee = $11
+	WHERE id = $1`,
+		paymentID, order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency, order.Payment.Provider, order.Payment.Amount,
+		order.Payment.PaymentDT, order.Payment.Bank, order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
 	if err != nil {
-		return fmt.Errorf("Insert order failed: %w", err)
+		return fmt.Errorf("update payment failed: %w", err)
 	}
 
-	// 4. Items
+	err = tx.QueryRow(ctx, `UPDATE orders SET track_number = $2, entry = $3, locale = $4, internal_signature = $5,
+	customer_id = $6, delivery_service = $7, shardkey = $8, sm_id = $9, date_created = $10, oof_shard = $11,
+	payload_hash = $12, version = version + 1
+	WHERE order_uid = $1
+	RETURNING status`,
+		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerID, order.DeliveryService, order.ShardKey, order.SmID, order.DateCreated, order.OofShard, hash).Scan(&order.Status)
+	if err != nil {
+		return fmt.Errorf("update order failed: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM items WHERE order_uid = $1`, order.OrderUID); err != nil {
+		return fmt.Errorf("delete items failed: %w", err)
+	}
+	return insertItems(ctx, tx, order)
+}
+
+// archiveOrder сохраняет текущую версию заказа в order_versions перед перезаписью
+func archiveOrder(ctx context.Context, tx pgx.Tx, orderUID string) error {
+	_, err := tx.Exec(ctx, `INSERT INTO order_versions (order_uid, version, payload)
+	SELECT o.order_uid, o.version, jsonb_build_object(
+		'order', to_jsonb(o) - 'payload_hash',
+		'delivery', to_jsonb(d),
+		'payment', to_jsonb(p),
+		'items', COALESCE((SELECT jsonb_agg(to_jsonb(i) ORDER BY i.id) FROM items i WHERE i.order_uid = o.order_uid), '[]'))
+	FROM orders o
+	JOIN delivery d ON d.id = o.delivery_id
+	JOIN payment p ON p.id = o.payment_id
+	WHERE o.order_uid = $1`, orderUID)
+	if err != nil {
+		return fmt.Errorf("archive order version failed: %w", err)
+	}
+	return nil
+}
+
+func insertItems(ctx context.Context, tx pgx.Tx, order *models.Order) error {
 	for _, item := range order.Items {
-		_, err = tx.Exec(ctx, `INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
+		_, err := tx.Exec(ctx, `INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
 			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`,
 			order.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.RID, item.Name,
 			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status)
@@ -75,26 +270,33 @@ func (r *Repository) SaveOrder(ctx context.Context, order *models.Order) error {
 			return fmt.Errorf("Insert item failed: %w", err)
 		}
 	}
-
-	// Commit
-	if err = tx.Commit(ctx); err != nil {
-		return fmt.Errorf("commit failed: %w", err)
-	}
 	return nil
 }
 
+// querier — общая часть пула соединений и транзакции
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
 func (r *Repository) GetOrderByUID(ctx context.Context, uid string) (*models.Order, error) {
+	return getOrder(ctx, r.db, uid)
+}
+
+func getOrder(ctx context.Context, db querier, uid string) (*models.Order, error) {
 	var order models.Order
 	var deliveryID, paymentID int
+	var signature, requestID *string
 
-	err := r.db.QueryRow(ctx, `SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
+	err := db.QueryRow(ctx, `SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
 			   o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created,
-			   o.oof_shard, o.delivery_id, o.payment_id
+			   o.oof_shard, o.status, o.change_seq, o.delivery_id, o.payment_id
 			FROM orders o
 			WHERE o.order_uid = $1
-			`, uid).Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature,
+			`, uid).Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &signature,
 		&order.CustomerID, &order.DeliveryService, &order.ShardKey, &order.SmID,
-		&order.DateCreated, &order.OofShard, &deliveryID, &paymentID)
+		&order.DateCreated, &order.OofShard, &order.Status, &order.ChangeSeq, &deliveryID, &paymentID)
+	order.InternalSignature = stringOrEmpty(signature)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrOrderNotFound
@@ -103,7 +305,7 @@ func (r *Repository) GetOrderByUID(ctx context.Context, uid string) (*models.Ord
 	}
 
 	// 2. Delivery
-	err = r.db.QueryRow(ctx, `SELECT name, phone, zip, city, address, region, email
+	err = db.QueryRow(ctx, `SELECT name, phone, zip, city, address, region, email
 	FROM delivery WHERE id = $1`, deliveryID).Scan(
 		&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip,
 		&order.Delivery.City, &order.Delivery.Address, &order.Delivery.Region,
@@ -116,12 +318,13 @@ func (r *Repository) GetOrderByUID(ctx context.Context, uid string) (*models.Ord
 	}
 
 	// 3. Payment
-	err = r.db.QueryRow(ctx, `SELECT transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
+	err = db.QueryRow(ctx, `SELECT transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
 	FROM payment WHERE id = $1`, paymentID).Scan(
-		&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency,
+		&order.Payment.Transaction, &requestID, &order.Payment.Currency,
 		&order.Payment.Provider, &order.Payment.Amount, &order.Payment.PaymentDT,
 		&order.Payment.Bank, &order.Payment.DeliveryCost, &order.Payment.GoodsTotal,
 		&order.Payment.CustomFee)
+	order.Payment.RequestID = stringOrEmpty(requestID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrOrderNotFound
@@ -130,7 +333,7 @@ func (r *Repository) GetOrderByUID(ctx context.Context, uid string) (*models.Ord
 	}
 
 	// 4. Items
-	rows, err := r.db.Query(ctx, `SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+	rows, err := db.Query(ctx, `SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
 	FROM items WHERE order_uid = $1`, order.OrderUID)
 	if err != nil {
 		return nil, fmt.Errorf("get items failed: %w", err)
@@ -173,3 +376,223 @@ func (r *Repository) GetAllOrderUIDs(ctx context.Context) ([]string, error) {
 	}
 	return uids, nil
 }
+
+// ChangeWatermark — отметка, до которой все изменения заказов зафиксированы: xmin текущего снимка транзакций.
+// Транзакции с меньшим номером завершены, поэтому изменения после отметки находятся по change_xid (migrations/0009)
+func (r *Repository) ChangeWatermark(ctx context.Context) (int64, error) {
+	var xmin int64
+	if err := r.db.QueryRow(ctx, `SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint`).Scan(&xmin); err != nil {
+		return 0, fmt.Errorf("get change watermark failed: %w", err)
+	}
+	return xmin, nil
+}
+
+// DeletedSince — UID заказов, удалённых транзакциями не старше отметки ChangeWatermark
+func (r *Repository) DeletedSince(ctx context.Context, watermark int64) ([]string, error) {
+	rows, err := r.db.Query(ctx, `SELECT order_uid FROM order_tombstones WHERE change_xid >= $1::bigint::text::xid8`, watermark)
+	if err != nil {
+		return nil, fmt.Errorf("get deleted orders failed: %w", err)
+	}
+	defer rows.Close()
+
+	var uids []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("scan deleted order failed: %w", err)
+		}
+		uids = append(uids, uid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get deleted orders failed: %w", err)
+	}
+	return uids, nil
+}
+
+// OrderFilter — ограничения выборки для массовой загрузки заказов
+type OrderFilter struct {
+	CreatedAfter time.Time // нулевое время — без ограничения
+	ChangedSince int64     // 0 — без ограничения; иначе заказы, изменённые транзакциями не старше отметки ChangeWatermark
+	Limit        int       // 0 — все заказы; иначе самые свежие Limit штук
+}
+
+// StreamedOrder — заказ, собранный при потоковой выборке; если собрать его не удалось,
+// Order равен nil, а Err содержит причину
+type StreamedOrder struct {
+	OrderUID string
+	Order    *models.Order
+	Err      error
+}
+
+// StreamOrders — постранично отдаёт полностью собранные заказы, от новых к старым.
+// Каждая страница — один запрос: доставка и оплата присоединяются JOIN, товары агрегируются в JSON.
+// Ошибка fn прерывает выборку и возвращается вызывающему
+func (r *Repository) StreamOrders(ctx context.Context, filter OrderFilter, pageSize int, fn func(page []StreamedOrder) error) error {
+	if pageSize <= 0 {
+		return fmt.Errorf("page size must be positive, got %d", pageSize)
+	}
+
+	var (
+		fetched  int
+		lastDate time.Time
+		lastUID  string
+	)
+	for {
+		limit := pageSize
+		if filter.Limit > 0 {
+			if remaining := filter.Limit - fetched; remaining < limit {
+				limit = remaining
+			}
+		}
+		if limit <= 0 {
+			return nil
+		}
+
+		page, err := r.orderPage(ctx, filter, lastDate, lastUID, fetched > 0, limit)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+		fetched += len(page)
+		lastDate, lastUID = page[len(page)-1].dateCreated, page[len(page)-1].OrderUID
+
+		orders := make([]StreamedOrder, len(page))
+		for i, row := range page {
+			orders[i] = row.StreamedOrder
+		}
+		if err := fn(orders); err != nil {
+			return err
+		}
+		if len(page) < limit {
+			return nil
+		}
+	}
+}
+
+type pageRow struct {
+	StreamedOrder
+	dateCreated time.Time
+}
+
+// orderPage — одна страница выборки с keyset-пагинацией по (date_created, order_uid)
+func (r *Repository) orderPage(ctx context.Context, filter OrderFilter, lastDate time.Time, lastUID string, hasCursor bool, limit int) ([]pageRow, error) {
+	var (
+		conds []string
+		args  []any
+	)
+	if !filter.CreatedAfter.IsZero() {
+		args = append(args, filter.CreatedAfter)
+		conds = append(conds, fmt.Sprintf("o.date_created > $%d", len(args)))
+	}
+	if filter.ChangedSince > 0 {
+		args = append(args, filter.ChangedSince)
+		conds = append(conds, fmt.Sprintf("o.change_xid >= $%d::bigint::text::xid8", len(args)))
+	}
+	if hasCursor {
+		args = append(args, lastDate, lastUID)
+		conds = append(conds, fmt.Sprintf("(o.date_created, o.order_uid) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, limit)
+
+	rows, err := r.db.Query(ctx, `SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
+			   o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, o.status,
+			   row_to_json(d), row_to_json(p),
+			   COALESCE((SELECT json_agg(i ORDER BY i.id) FROM items i WHERE i.order_uid = o.order_uid), '[]')
+			FROM orders o
+			LEFT JOIN delivery d ON d.id = o.delivery_id
+			LEFT JOIN payment p ON p.id = o.payment_id
+			`+where+`
+			ORDER BY o.date_created DESC, o.order_uid DESC
+			LIMIT $`+fmt.Sprint(len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("stream orders failed: %w", err)
+	}
+	defer rows.Close()
+
+	page := make([]pageRow, 0, limit)
+	for rows.Next() {
+		var (
+			order                    models.Order
+			signature                *string
+			delivery, payment, items []byte
+		)
+		if err := rows.Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &signature,
+			&order.CustomerID, &order.DeliveryService, &order.ShardKey, &order.SmID, &order.DateCreated, &order.OofShard,
+			&order.Status, &delivery, &payment, &items); err != nil {
+			row, keyErr := unscannedRow(rows, err)
+			if keyErr != nil {
+				return nil, fmt.Errorf("scan streamed order failed: %w", err)
+			}
+			page = append(page, row)
+			continue
+		}
+		order.InternalSignature = stringOrEmpty(signature)
+		row := pageRow{StreamedOrder: StreamedOrder{OrderUID: order.OrderUID}, dateCreated: order.DateCreated}
+		if err := assembleOrder(&order, delivery, payment, items); err != nil {
+			row.Err = err
+		} else {
+			row.Order = &order
+		}
+		page = append(page, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("streamed orders rows error: %w", err)
+	}
+	return page, nil
+}
+
+// unscannedRow — строка выборки, которую не удалось прочитать: заказ отдаётся с ошибкой и пропускается,
+// а выборка продолжается с его ключа. Ошибка возвращается, если не читается и сам ключ
+func unscannedRow(rows pgx.Rows, scanErr error) (pageRow, error) {
+	values, err := rows.Values()
+	if err != nil {
+		return pageRow{}, err
+	}
+	uid, ok := values[0].(string)
+	if !ok {
+		return pageRow{}, errors.New("order_uid is not readable")
+	}
+	date, ok := values[9].(time.Time)
+	if !ok {
+		return pageRow{}, errors.New("date_created is not readable")
+	}
+	return pageRow{
+		StreamedOrder: StreamedOrder{OrderUID: uid, Err: fmt.Errorf("scan order failed: %w", scanErr)},
+		dateCreated:   date,
+	}, nil
+}
+
+// stringOrEmpty — значение столбца, допускающего NULL; NULL читается как пустая строка
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// assembleOrder — дополняет заказ доставкой, оплатой и товарами из JSON-представления строк
+func assembleOrder(order *models.Order, delivery, payment, items []byte) error {
+	if delivery == nil {
+		return errors.New("delivery row is missing")
+	}
+	if payment == nil {
+		return errors.New("payment row is missing")
+	}
+	if err := json.Unmarshal(delivery, &order.Delivery); err != nil {
+		return fmt.Errorf("decode delivery failed: %w", err)
+	}
+	if err := json.Unmarshal(payment, &order.Payment); err != nil {
+		return fmt.Errorf("decode payment failed: %w", err)
+	}
+	order.Items = []models.Items{}
+	if err := json.Unmarshal(items, &order.Items); err != nil {
+		return fmt.Errorf("decode items failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssembleOrder(t *testing.T) {
+	order := models.Order{OrderUID: "b563feb7b2b84b6test"}
+	delivery := []byte(`{"id":1,"name":"Test Testov","phone":"+9720000000","zip":"2639809","city":"Kiryat Mozkin",
+		"address":"Ploshad Mira 15","region":"Kraiot","email":"test@gmail.com"}`)
+	payment := []byte(`{"id":1,"transaction":"b563feb7b2b84b6test","request_id":null,"currency":"USD","provider":"wbpay",
+		"amount":1817,"payment_dt":1637907727,"bank":"alpha","delivery_cost":1500,"goods_total":317,"custom_fee":0}`)
+	items := []byte(`[{"id":1,"order_uid":"b563feb7b2b84b6test","chrt_id":9934930,"track_number":"WBILMTESTTRACK",
+		"price":453,"rid":"ab4219087a764ae0btest","name":"Mascaras","sale":30,"size":"0","total_price":317,
+		"nm_id":2389212,"brand":"Vivienne Sabo","status":202}]`)
+
+	require.NoError(t, assembleOrder(&order, delivery, payment, items))
+	assert.Equal(t, "Test Testov", order.Delivery.Name)
+	assert.Equal(t, "", order.Payment.RequestID)
+	assert.Equal(t, int64(1637907727), order.Payment.PaymentDT)
+	require.Len(t, order.Items, 1)
+	assert.Equal(t, 9934930, order.Items[0].ChrtID)
+}
+
+func TestAssembleOrder_Broken(t *testing.T) {
+	var order models.Order
+	assert.Error(t, assembleOrder(&order, nil, []byte(`{}`), []byte(`[]`)))
+	assert.Error(t, assembleOrder(&order, []byte(`{}`), nil, []byte(`[]`)))
+	assert.Error(t, assembleOrder(&order, []byte(`{}`), []byte(`{}`), []byte(`{"not":"an array"}`)))
+}
+
+func TestOrderHash(t *testing.T) {
+	order := &models.Order{OrderUID: "1", Items: []models.Items{{Name: "a"}},
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)}
+	first := orderHash(order)
+	assert.True(t, isCurrentHash(first))
+	assert.Equal(t, first, orderHash(order.Clone()))
+
+	// статус меняется событиями и в отпечаток не входит
+	paid := order.Clone()
+	paid.Status = models.StatusPaid
+	assert.Equal(t, first, orderHash(paid))
+	// столбец TIMESTAMP хранит время по часам без пояса и с точностью до микросекунды
+	read := order.Clone()
+	read.DateCreated = read.DateCreated.Add(400 * time.Nanosecond)
+	assert.Equal(t, first, orderHash(read))
+
+	changed := order.Clone()
+	changed.Items[0].Name = "b"
+	assert.NotEqual(t, first, orderHash(changed))
+	// поля не склеиваются: "ab"+"" и "a"+"b" различаются
+	assert.NotEqual(t, orderHash(&models.Order{OrderUID: "ab"}), orderHash(&models.Order{OrderUID: "a", TrackNumber: "b"}))
+}
+
+// hashTx: в БД уже есть заказ с заданным хэшем
+type hashTx struct {
+	fakeTx
+	hash []byte
+}
+
+func (tx hashTx) QueryRow(context.Context, string, ...interface{}) pgx.Row { return hashRow(tx.hash) }
+
+func (hashTx) Rollback(context.Context) error { return nil }
+
+type hashRow []byte
+
+func (r hashRow) Scan(dest ...interface{}) error {
+	*dest[0].(*[]byte) = r
+	return nil
+}
+
+type hashPool struct {
+	dbPool
+	hash []byte
+}
+
+func (p hashPool) Begin(context.Context) (pgx.Tx, error) { return hashTx{hash: p.hash}, nil }
+
+// после событий заказа повторно доставленное сообщение о создании ничего не перезаписывает
+func TestSaveOrder_RedeliveredCreateAfterEvents(t *testing.T) {
+	created := &models.Order{OrderUID: "1", Status: models.StatusCreated,
+		Delivery: models.Delivery{Name: "Test Testov", City: "Kiryat Mozkin"},
+		Payment:  models.Payment{Transaction: "1", Amount: 100},
+		Items:    []models.Items{{ChrtID: 1, Status: 202}}}
+	stored := created.Clone()
+	events := []models.Change{
+		&models.OrderPaid{Transaction: "tx-2", PaymentDT: 1637907727},
+		&models.ItemStatusChanged{ChrtID: 1, Status: 203},
+		&models.DeliveryUpdated{Delivery: models.Delivery{Name: "Test Testov", City: "Haifa"}},
+		&models.OrderCancelled{},
+	}
+	for _, e := range events {
+		require.NoError(t, e.Apply(stored))
+	}
+
+	// хэш, пересчитанный currentHash по строкам БД после событий
+	repo := &Repository{db: hashPool{hash: orderHash(stored)}, onConflict: ConflictReject}
+	result, err := repo.SaveOrder(context.Background(), created.Clone())
+	require.NoError(t, err)
+	assert.Equal(t, SaveUnchanged, result)
+}
+
+func TestCompareHash(t *testing.T) {
+	hash := orderHash(&models.Order{OrderUID: "1"})
+	other := orderHash(&models.Order{OrderUID: "2"})
+	reject := &Repository{onConflict: ConflictReject}
+	assert.Equal(t, SaveUnchanged, reject.compareHash(hash, hash))
+	assert.Equal(t, SaveConflict, reject.compareHash(hash, other))
+	assert.Equal(t, SaveUpdated, (&Repository{onConflict: ConflictOverwrite}).compareHash(hash, other))
+
+	// NULL и хэш прежнего формата пересчитываются, а не считаются конфликтом
+	assert.False(t, isCurrentHash(nil))
+	legacy := sha256.Sum256([]byte(`{"order_uid":"1"}`))
+	assert.False(t, isCurrentHash(legacy[:]))
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	for _, name := range []string{"reject", "overwrite", "version"} {
+		p, err := ParseConflictPolicy(name)
+		require.NoError(t, err)
+		assert.Equal(t, ConflictPolicy(name), p)
+	}
+	_, err := ParseConflictPolicy("ignore")
+	assert.Error(t, err)
+}
+
+func TestInsertOrderArgs_MatchPlaceholders(t *testing.T) {
+	order := &models.Order{OrderUID: "1", Items: []models.Items{{ChrtID: 1, Name: "a"}, {ChrtID: 2, Name: "b"}}}
+	args, err := insertOrderArgs(order, []byte{1})
+	require.NoError(t, err)
+
+	var placeholders int
+	for i := 1; strings.Contains(insertOrderSQL, fmt.Sprintf("$%d", i)); i++ {
+		placeholders = i
+	}
+	assert.Len(t, args, placeholders)
+	assert.Equal(t, []int{1, 2}, args[29])
+	assert.Equal(t, []string{"a", "b"}, args[33])
+	// событие outbox — сохраняемый заказ
+	var payload models.Order
+	require.NoError(t, json.Unmarshal(args[40].([]byte), &payload))
+	assert.Equal(t, order, &payload)
+}
+
+// execTx записывает запросы Exec; заказа в БД нет
+type execTx struct {
+	fakeTx
+	execs *[]string
+}
+
+func (tx execTx) Exec(_ context.Context, sql string, _ ...interface{}) (pgconn.CommandTag, error) {
+	*tx.execs = append(*tx.execs, sql)
+	return nil, nil
+}
+
+func (execTx) Rollback(context.Context) error { return nil }
+
+type execPool struct {
+	dbPool
+	execs *[]string
+}
+
+func (p execPool) Begin(context.Context) (pgx.Tx, error) { return execTx{execs: p.execs}, nil }
+
+// новый заказ сохраняется тем же запросом, что и в пакетной вставке, вместе с событием outbox
+func TestSaveOrder_InsertsWithBatchStatement(t *testing.T) {
+	var execs []string
+	repo := &Repository{db: execPool{execs: &execs}, onConflict: ConflictReject}
+	order := &models.Order{OrderUID: "1", Status: models.StatusPaid, Items: []models.Items{{ChrtID: 1}}}
+
+	result, err := repo.SaveOrder(context.Background(), order)
+	require.NoError(t, err)
+	assert.Equal(t, SaveInserted, result)
+	assert.Equal(t, models.StatusCreated, order.Status)
+	require.Len(t, execs, 2, "advisory lock and insert")
+	assert.Equal(t, insertOrderSQL, execs[1])
+}
+
+// storedTx: запросы выполняются успешно, RETURNING возвращает статус из БД
+type storedTx struct {
+	pgx.Tx
+	status string
+}
+
+func (storedTx) Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error) {
+	return nil, nil
+}
+
+func (tx storedTx) QueryRow(context.Context, string, ...interface{}) pgx.Row {
+	return statusRow(tx.status)
+}
+
+type statusRow string
+
+func (r statusRow) Scan(dest ...interface{}) error {
+	*dest[0].(*string) = string(r)
+	return nil
+}
+
+func TestUpdateOrder_KeepsStoredStatus(t *testing.T) {
+	// перезапись оплаченного заказа сообщением со статусом отправителя
+	order := &models.Order{OrderUID: "1", Status: models.StatusCancelled, Items: []models.Items{{ChrtID: 1}}}
+	require.NoError(t, updateOrder(context.Background(), storedTx{status: models.StatusPaid}, order, orderHash(order), 1, 1))
+	assert.Equal(t, models.StatusPaid, order.Status)
+}
+
+// pageRows — результат выборки orderPage; Scan, как pgx, не кладёт NULL в обычную строку
+type pageRows struct {
+	pgx.Rows
+	rows [][]interface{}
+	i    int
+}
+
+type pagePool struct {
+	dbPool
+	rows [][]interface{}
+}
+
+func (p pagePool) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return &pageRows{rows: p.rows}, nil
+}
+
+func (r *pageRows) Next() bool {
+	r.i++
+	return r.i <= len(r.rows)
+}
+
+func (r *pageRows) Scan(dest ...interface{}) error {
+	for i, v := range r.rows[r.i-1] {
+		d := reflect.ValueOf(dest[i]).Elem()
+		switch {
+		case v == nil && d.Kind() != reflect.Pointer:
+			return fmt.Errorf("can't scan NULL into %s", d.Type())
+		case v == nil:
+			d.SetZero()
+		case d.Kind() == reflect.Pointer:
+			p := reflect.New(d.Type().Elem())
+			p.Elem().Set(reflect.ValueOf(v))
+			d.Set(p)
+		default:
+			d.Set(reflect.ValueOf(v))
+		}
+	}
+	return nil
+}
+
+func (r *pageRows) Values() ([]interface{}, error) { return r.rows[r.i-1], nil }
+func (r *pageRows) Err() error                     { return nil }
+func (r *pageRows) Close()                         {}
+
+func TestStreamOrders_SkipsUnreadableRows(t *testing.T) {
+	date := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+	row := func(uid string, signature, customer interface{}) []interface{} {
+		return []interface{}{uid, "track", "WBIL", "en", signature, customer, "meest", "9", 99, date, "1", "created",
+			[]byte(`{"name":"Test"}`), []byte(`{"transaction":"t","request_id":null}`), []byte(`[]`)}
+	}
+	repo := &Repository{db: pagePool{rows: [][]interface{}{
+		row("signed", "sig", "test"),
+		row("unsigned", nil, "test"),
+		row("broken", "sig", nil),
+	}}}
+
+	var got []StreamedOrder
+	err := repo.StreamOrders(context.Background(), OrderFilter{}, 10, func(page []StreamedOrder) error {
+		got = append(got, page...)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	require.NoError(t, got[0].Err)
+	assert.Equal(t, "sig", got[0].Order.InternalSignature)
+	require.NoError(t, got[1].Err, "NULL internal_signature")
+	assert.Equal(t, "", got[1].Order.InternalSignature)
+	assert.Equal(t, "broken", got[2].OrderUID)
+	assert.Nil(t, got[2].Order)
+	assert.Error(t, got[2].Err)
+}
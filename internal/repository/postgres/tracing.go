@@ -0,0 +1,202 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/pkg/logger"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/MikhaylovMaks/wb_techl0/internal/repository/postgres"
+
+// dbPool — методы пула соединений, которыми пользуется репозиторий
+type dbPool interface {
+	querier
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// tracedPool записывает каждый запрос к БД, в том числе запросы транзакций, отдельным спаном
+// и пишет его в лог из контекста на уровне debug
+type tracedPool struct {
+	pool dbPool
+}
+
+func (p tracedPool) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, q := startQuery(ctx, sql)
+	tag, err := p.pool.Exec(ctx, sql, args...)
+	q.end(err)
+	return tag, err
+}
+
+func (p tracedPool) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, q := startQuery(ctx, sql)
+	rows, err := p.pool.Query(ctx, sql, args...)
+	if err != nil {
+		q.end(err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, q: q}, nil
+}
+
+func (p tracedPool) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	ctx, q := startQuery(ctx, sql)
+	return tracedRow{row: p.pool.QueryRow(ctx, sql, args...), q: q}
+}
+
+func (p tracedPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	ctx, q := startQuery(ctx, "BEGIN")
+	tx, err := p.pool.Begin(ctx)
+	q.end(err)
+	if err != nil {
+		return nil, err
+	}
+	return tracedTx{Tx: tx}, nil
+}
+
+// tracedTx — транзакция, запросы которой записываются спанами
+type tracedTx struct {
+	pgx.Tx
+}
+
+func (t tracedTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, q := startQuery(ctx, sql)
+	tag, err := t.Tx.Exec(ctx, sql, args...)
+	q.end(err)
+	return tag, err
+}
+
+func (t tracedTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, q := startQuery(ctx, sql)
+	rows, err := t.Tx.Query(ctx, sql, args...)
+	if err != nil {
+		q.end(err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, q: q}, nil
+}
+
+func (t tracedTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	ctx, q := startQuery(ctx, sql)
+	return tracedRow{row: t.Tx.QueryRow(ctx, sql, args...), q: q}
+}
+
+// SendBatch записывает пакет одним спаном, который завершается при закрытии результатов
+func (t tracedTx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	ctx, q := startQuery(ctx, "BATCH")
+	q.span.SetAttributes(attribute.Int("db.operation.batch.size", b.Len()))
+	return &tracedBatch{BatchResults: t.Tx.SendBatch(ctx, b), q: q}
+}
+
+func (t tracedTx) Commit(ctx context.Context) error {
+	ctx, q := startQuery(ctx, "COMMIT")
+	err := t.Tx.Commit(ctx)
+	q.end(err)
+	return err
+}
+
+// tracedRows завершает запрос, когда строки прочитаны или закрыты
+type tracedRows struct {
+	pgx.Rows
+	q *query
+}
+
+func (r *tracedRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.q.end(r.Rows.Err())
+	return false
+}
+
+func (r *tracedRows) Close() {
+	r.Rows.Close()
+	r.q.end(r.Rows.Err())
+}
+
+// tracedRow завершает запрос при чтении строки
+type tracedRow struct {
+	row pgx.Row
+	q   *query
+}
+
+func (r tracedRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	// отсутствие строки — обычный результат, а не ошибка запроса
+	if errors.Is(err, pgx.ErrNoRows) {
+		r.q.end(nil)
+	} else {
+		r.q.end(err)
+	}
+	return err
+}
+
+// tracedBatch отмечает в спане пакета ошибки его запросов
+type tracedBatch struct {
+	pgx.BatchResults
+	q *query
+}
+
+func (b *tracedBatch) Exec() (pgconn.CommandTag, error) {
+	tag, err := b.BatchResults.Exec()
+	if err != nil {
+		b.q.span.RecordError(err)
+	}
+	return tag, err
+}
+
+func (b *tracedBatch) Close() error {
+	err := b.BatchResults.Close()
+	b.q.end(err)
+	return err
+}
+
+// query — выполняемый запрос: его спан и запись в лог уровня debug по завершении
+type query struct {
+	ctx   context.Context
+	op    string
+	span  trace.Span
+	start time.Time
+	done  bool
+}
+
+// startQuery начинает спан запроса; имя спана — операция SQL (SELECT, INSERT, ...)
+func startQuery(ctx context.Context, sql string) (context.Context, *query) {
+	op := sqlOperation(sql)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, op, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(op), semconv.DBQueryText(sql)))
+	return ctx, &query{ctx: ctx, op: op, span: span, start: time.Now()}
+}
+
+// end завершает запрос; повторный вызов (Close после Next) ничего не делает
+func (q *query) end(err error) {
+	if q.done {
+		return
+	}
+	q.done = true
+	if err != nil {
+		q.span.RecordError(err)
+		q.span.SetStatus(codes.Error, err.Error())
+	}
+	q.span.End()
+	// ошибки запросов логируют вызывающие методы, здесь — только для отладки
+	logger.FromContext(q.ctx, nil).Debugw("db query", "op", q.op, "dur_ms", time.Since(q.start).Milliseconds(), "err", err)
+}
+
+// sqlOperation — первое ключевое слово запроса
+func sqlOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MikhaylovMaks/wb_techl0/pkg/tracing/tracingtest"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// fakePool отдаёт fakeTx; запросы вне транзакции не используются
+type fakePool struct {
+	dbPool
+}
+
+func (fakePool) Begin(context.Context) (pgx.Tx, error) { return fakeTx{}, nil }
+
+// fakeTx: INSERT завершается ошибкой, SELECT не находит строк
+type fakeTx struct {
+	pgx.Tx
+}
+
+func (fakeTx) Exec(_ context.Context, sql string, _ ...interface{}) (pgconn.CommandTag, error) {
+	if sqlOperation(sql) == "INSERT" {
+		return nil, errors.New("insert failed")
+	}
+	return nil, nil
+}
+
+func (fakeTx) QueryRow(context.Context, string, ...interface{}) pgx.Row { return noRow{} }
+
+func (fakeTx) Commit(context.Context) error { return nil }
+
+type noRow struct{}
+
+func (noRow) Scan(...interface{}) error { return pgx.ErrNoRows }
+
+func TestTracedPool_SpanPerQuery(t *testing.T) {
+	exporter := tracingtest.NewExporter(t)
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+
+	db := tracedPool{pool: fakePool{}}
+	tx, err := db.Begin(ctx)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, "INSERT INTO orders VALUES ($1)", "uid")
+	assert.Error(t, err)
+	var uid string
+	assert.ErrorIs(t, tx.QueryRow(ctx, "  select order_uid FROM orders WHERE order_uid = $1", "uid").Scan(&uid), pgx.ErrNoRows)
+	require.NoError(t, tx.Commit(ctx))
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 5)
+	names := make([]string, 0, len(spans))
+	for _, s := range spans[:4] {
+		names = append(names, s.Name)
+		assert.Equal(t, parent.SpanContext().SpanID(), s.Parent.SpanID(), s.Name)
+	}
+	assert.Equal(t, []string{"BEGIN", "INSERT", "SELECT", "COMMIT"}, names)
+
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	// отсутствие строки ошибкой запроса не считается
+	assert.Equal(t, codes.Unset, spans[2].Status.Code)
+	attrs := map[string]string{}
+	for _, a := range spans[1].Attributes {
+		attrs[string(a.Key)] = a.Value.Emit()
+	}
+	assert.Equal(t, "postgresql", attrs["db.system"])
+	assert.Equal(t, "INSERT INTO orders VALUES ($1)", attrs["db.query.text"])
+}
@@ -0,0 +1,395 @@
+package storage
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+)
+
+// политика вытеснения записей из ограниченного кэша
+type EvictionPolicy string
+
+const (
+	PolicyLRU EvictionPolicy = "lru"
+	PolicyLFU EvictionPolicy = "lfu"
+)
+
+// кэш с ограничением по количеству записей и примерному объёму в байтах;
+// нулевой лимит означает отсутствие ограничения. Как и MemoryStorage, хранит копии заказов
+type BoundedStorage struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	defaultTTL time.Duration
+	entries    map[string]*entry
+	evictor    evictor
+	evicted    uint64
+	expired    uint64
+}
+
+type entry struct {
+	key       string
+	order     *models.Order
+	size      int64
+	expiresAt time.Time
+	accessed  bool
+	encoded   *Encoded
+
+	// служебные поля политик вытеснения
+	elem  *list.Element
+	freq  uint64
+	tick  uint64
+	index int
+}
+
+// конструктор ограниченного кэша; defaultTTL задаёт срок жизни записей (0 — бессрочно)
+func NewBoundedStorage(maxEntries int, maxBytes int64, policy EvictionPolicy, defaultTTL time.Duration) (*BoundedStorage, error) {
+	if maxEntries < 0 || maxBytes < 0 {
+		return nil, fmt.Errorf("cache limits must not be negative")
+	}
+	var ev evictor
+	switch policy {
+	case PolicyLRU, "":
+		ev = newLRU()
+	case PolicyLFU:
+		ev = newLFU()
+	default:
+		return nil, fmt.Errorf("unknown eviction policy %q", policy)
+	}
+	return &BoundedStorage{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		defaultTTL: defaultTTL,
+		entries:    make(map[string]*entry),
+		evictor:    ev,
+	}, nil
+}
+
+// получение заказа из кэша
+func (s *BoundedStorage) Get(orderUID string) (*models.Order, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.lookup(orderUID)
+	if !ok {
+		return nil, false
+	}
+	return e.order.Clone(), true
+}
+
+// готовое JSON-представление заказа; строится при первом запросе и вместе со сжатыми вариантами
+// учитывается в объёме кэша, а лишние записи при этом вытесняются так же, как в Set
+func (s *BoundedStorage) GetEncoded(orderUID string) (*Encoded, bool) {
+	s.mu.Lock()
+	e, ok := s.lookup(orderUID)
+	if !ok {
+		s.mu.Unlock()
+		return nil, false
+	}
+	enc, order := e.encoded, e.order
+	s.mu.Unlock()
+	if enc != nil {
+		return enc, true
+	}
+
+	// заказ в записи не меняется после Set, поэтому кодируем без блокировки
+	enc, err := NewEncoded(order)
+	if err != nil {
+		return nil, false
+	}
+	enc.onCompress = func(n int) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.grow(e, enc, int64(n))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// запись могли заменить или удалить, пока шло кодирование
+	if cur, ok := s.entries[orderUID]; ok && cur == e && cur.encoded == nil {
+		cur.encoded = enc
+		s.grow(e, enc, int64(len(enc.JSON())))
+	}
+	return enc, true
+}
+
+// grow добавляет к объёму записи n байт её представления enc и вытесняет лишние записи,
+// в том числе, возможно, саму e; вызывается под блокировкой
+func (s *BoundedStorage) grow(e *entry, enc *Encoded, n int64) {
+	if cur, ok := s.entries[e.key]; !ok || cur != e || e.encoded != enc {
+		return
+	}
+	e.size += n
+	s.bytes += n
+	s.evict(0, 0)
+}
+
+// lookup — действующая запись с отметкой обращения; вызывается под блокировкой
+func (s *BoundedStorage) lookup(orderUID string) (*entry, bool) {
+	e, ok := s.entries[orderUID]
+	if !ok {
+		return nil, false
+	}
+	if expired(e.expiresAt, time.Now()) {
+		s.removeEntry(e)
+		s.expired++
+		return nil, false
+	}
+	e.accessed = true
+	s.evictor.touch(e)
+	return e, true
+}
+
+// добавление или обновление заказа в кэше с вытеснением лишних записей
+func (s *BoundedStorage) Set(orderUID string, order *models.Order) {
+	s.SetWithTTL(orderUID, order, s.defaultTTL)
+}
+
+// добавление или обновление заказа с собственным сроком жизни
+func (s *BoundedStorage) SetWithTTL(orderUID string, order *models.Order, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := orderSize(order)
+	var freq uint64
+	if old, ok := s.entries[orderUID]; ok {
+		freq = old.freq
+		s.removeEntry(old)
+	}
+	// заказ, который в одиночку больше лимита, не кэшируем
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return
+	}
+	s.evict(1, size)
+
+	e := &entry{key: orderUID, order: order.Clone(), size: size, expiresAt: expiresAt(ttl), freq: freq}
+	s.entries[orderUID] = e
+	s.bytes += size
+	s.evictor.add(e)
+}
+
+// удаление конкретного заказа из кэша
+func (s *BoundedStorage) Invalidate(orderUID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[orderUID]; ok {
+		s.removeEntry(e)
+	}
+}
+
+// очистка всего кэша
+func (s *BoundedStorage) InvalidateAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[string]*entry)
+	s.bytes = 0
+	s.evictor.reset()
+}
+
+// удаляет просроченные записи и возвращает их количество
+func (s *BoundedStorage) DeleteExpired() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var n int
+	for _, e := range s.entries {
+		if expired(e.expiresAt, now) {
+			s.removeEntry(e)
+			n++
+		}
+	}
+	s.expired += uint64(n)
+	return n
+}
+
+// возвращает UID запрошенных после последней записи заказов, срок которых истекает в течение within
+func (s *BoundedStorage) ExpiringSoon(within time.Duration) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deadline := time.Now().Add(within)
+	var uids []string
+	for uid, e := range s.entries {
+		if !e.expiresAt.IsZero() && e.expiresAt.Before(deadline) && e.accessed {
+			uids = append(uids, uid)
+		}
+	}
+	return uids
+}
+
+// обходит действующие записи под блокировкой; fn возвращает false, чтобы остановить обход.
+// fn получает сам закэшированный заказ и не должна его изменять
+func (s *BoundedStorage) Range(fn func(orderUID string, order *models.Order) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for uid, e := range s.entries {
+		if expired(e.expiresAt, now) {
+			continue
+		}
+		if !fn(uid, e.order) {
+			return
+		}
+	}
+}
+
+// количество записей в кэше
+func (s *BoundedStorage) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// примерный объём закэшированных заказов в байтах
+func (s *BoundedStorage) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytes
+}
+
+// число записей, вытесненных из-за лимитов и удалённых по истечении срока
+func (s *BoundedStorage) EvictionStats() (evicted, expired uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.evicted, s.expired
+}
+
+func (s *BoundedStorage) overflows(addEntries int, addBytes int64) bool {
+	if s.maxEntries > 0 && len(s.entries)+addEntries > s.maxEntries {
+		return true
+	}
+	return s.maxBytes > 0 && s.bytes+addBytes > s.maxBytes
+}
+
+// evict вытесняет записи, пока с добавлением addEntries записей и addBytes байт кэш превышает лимиты
+func (s *BoundedStorage) evict(addEntries int, addBytes int64) {
+	for len(s.entries) > 0 && s.overflows(addEntries, addBytes) {
+		s.removeEntry(s.evictor.victim())
+		s.evicted++
+	}
+}
+
+func (s *BoundedStorage) removeEntry(e *entry) {
+	s.evictor.remove(e)
+	delete(s.entries, e.key)
+	s.bytes -= e.size
+}
+
+// orderSize — грубая оценка памяти, занимаемой заказом
+func orderSize(order *models.Order) int64 {
+	if order == nil {
+		return 0
+	}
+	size := int64(unsafe.Sizeof(*order)) +
+		strLen(order.OrderUID, order.TrackNumber, order.Entry, order.Locale,
+			order.InternalSignature, order.CustomerID, order.DeliveryService,
+			order.ShardKey, order.OofShard) +
+		strLen(order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip,
+			order.Delivery.City, order.Delivery.Address, order.Delivery.Region,
+			order.Delivery.Email) +
+		strLen(order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency,
+			order.Payment.Provider, order.Payment.Bank)
+	for _, item := range order.Items {
+		size += int64(unsafe.Sizeof(item)) +
+			strLen(item.TrackNumber, item.RID, item.Name, item.Size, item.Brand)
+	}
+	return size
+}
+
+func strLen(ss ...string) int64 {
+	var n int64
+	for _, s := range ss {
+		n += int64(len(s))
+	}
+	return n
+}
+
+// evictor — порядок вытеснения записей; вызывается под блокировкой кэша
+type evictor interface {
+	add(e *entry)
+	touch(e *entry)
+	remove(e *entry)
+	victim() *entry
+	reset()
+}
+
+// LRU: вытесняется запись, к которой дольше всего не обращались
+type lru struct {
+	ll *list.List
+}
+
+func newLRU() *lru {
+	return &lru{ll: list.New()}
+}
+
+func (l *lru) add(e *entry)    { e.elem = l.ll.PushFront(e) }
+func (l *lru) touch(e *entry)  { l.ll.MoveToFront(e.elem) }
+func (l *lru) remove(e *entry) { l.ll.Remove(e.elem) }
+func (l *lru) reset()          { l.ll.Init() }
+
+func (l *lru) victim() *entry {
+	return l.ll.Back().Value.(*entry)
+}
+
+// LFU: вытесняется запись с наименьшим числом обращений,
+// при равенстве — та, к которой обращались раньше
+type lfu struct {
+	h     lfuHeap
+	clock uint64
+}
+
+func newLFU() *lfu {
+	return &lfu{}
+}
+
+func (l *lfu) add(e *entry) {
+	l.clock++
+	e.tick = l.clock
+	heap.Push(&l.h, e)
+}
+
+func (l *lfu) touch(e *entry) {
+	l.clock++
+	e.freq++
+	e.tick = l.clock
+	heap.Fix(&l.h, e.index)
+}
+
+func (l *lfu) remove(e *entry) { heap.Remove(&l.h, e.index) }
+func (l *lfu) victim() *entry  { return l.h[0] }
+func (l *lfu) reset()          { l.h = nil }
+
+type lfuHeap []*entry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
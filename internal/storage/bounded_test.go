@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/pii"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoundedStorage_LRUEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, err := NewBoundedStorage(2, 0, PolicyLRU, 0)
+	require.NoError(t, err)
+
+	cache.Set("1", &models.Order{OrderUID: "1"})
+	cache.Set("2", &models.Order{OrderUID: "2"})
+	cache.Get("1")
+	cache.Set("3", &models.Order{OrderUID: "3"})
+
+	_, ok1 := cache.Get("1")
+	_, ok2 := cache.Get("2")
+	_, ok3 := cache.Get("3")
+	assert.True(t, ok1)
+	assert.False(t, ok2)
+	assert.True(t, ok3)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestBoundedStorage_LFUEvictsLeastFrequentlyUsed(t *testing.T) {
+	cache, err := NewBoundedStorage(2, 0, PolicyLFU, 0)
+	require.NoError(t, err)
+
+	cache.Set("1", &models.Order{OrderUID: "1"})
+	cache.Set("2", &models.Order{OrderUID: "2"})
+	cache.Get("1")
+	cache.Get("1")
+	cache.Get("2")
+	cache.Set("3", &models.Order{OrderUID: "3"})
+
+	_, ok1 := cache.Get("1")
+	_, ok2 := cache.Get("2")
+	_, ok3 := cache.Get("3")
+	assert.True(t, ok1)
+	assert.False(t, ok2)
+	assert.True(t, ok3)
+}
+
+func TestBoundedStorage_MaxBytes(t *testing.T) {
+	order := &models.Order{OrderUID: "1"}
+	size := orderSize(order)
+	cache, err := NewBoundedStorage(0, size*2, PolicyLRU, 0)
+	require.NoError(t, err)
+
+	cache.Set("1", &models.Order{OrderUID: "1"})
+	cache.Set("2", &models.Order{OrderUID: "2"})
+	cache.Set("3", &models.Order{OrderUID: "3"})
+
+	assert.Equal(t, 2, cache.Len())
+	assert.LessOrEqual(t, cache.Bytes(), size*2)
+	_, ok := cache.Get("1")
+	assert.False(t, ok)
+
+	// заказ больше лимита целиком не кэшируется
+	big := &models.Order{OrderUID: "big", Items: make([]models.Items, 10)}
+	cache.Set("big", big)
+	_, ok = cache.Get("big")
+	assert.False(t, ok)
+}
+
+// JSON и сжатые варианты заказа входят в объём кэша и вытесняют лишние записи
+func TestBoundedStorage_EncodedCountsTowardsMaxBytes(t *testing.T) {
+	size := orderSize(&models.Order{OrderUID: "1"})
+	enc, err := NewEncoded(&models.Order{OrderUID: "2"})
+	require.NoError(t, err)
+	limit := 2*size + int64(len(enc.JSON())+len(enc.Gzip()))
+	cache, err := NewBoundedStorage(0, limit, PolicyLRU, 0)
+	require.NoError(t, err)
+
+	cache.Set("1", &models.Order{OrderUID: "1"})
+	cache.Set("2", &models.Order{OrderUID: "2"})
+	got, ok := cache.GetEncoded("2")
+	require.True(t, ok)
+	got.Gzip()
+	assert.Equal(t, limit, cache.Bytes())
+	assert.Equal(t, 2, cache.Len())
+
+	got.Brotli()
+	assert.Equal(t, 1, cache.Len())
+	assert.LessOrEqual(t, cache.Bytes(), limit)
+	_, ok = cache.Get("1")
+	assert.False(t, ok)
+
+}
+
+// маскированные представления и их сжатые варианты тоже входят в объём записи
+func TestBoundedStorage_MaskedCountsTowardsMaxBytes(t *testing.T) {
+	cache, err := NewBoundedStorage(0, 0, PolicyLRU, 0)
+	require.NoError(t, err)
+	cache.Set("1", &models.Order{OrderUID: "1", Delivery: models.Delivery{Name: "Test Testov"}})
+
+	enc, ok := cache.GetEncoded("1")
+	require.True(t, ok)
+	before := cache.Bytes()
+	masked, err := enc.Masked(pii.MaskPartial)
+	require.NoError(t, err)
+	assert.Equal(t, before+int64(len(masked.JSON())), cache.Bytes())
+
+	gz := masked.Gzip()
+	assert.Equal(t, before+int64(len(masked.JSON())+len(gz)), cache.Bytes())
+
+	// повторный запрос режима ничего не добавляет
+	_, err = enc.Masked(pii.MaskPartial)
+	require.NoError(t, err)
+	assert.Equal(t, before+int64(len(masked.JSON())+len(gz)), cache.Bytes())
+}
+
+func TestBoundedStorage_UpdateKeepsSingleEntry(t *testing.T) {
+	cache, err := NewBoundedStorage(2, 0, PolicyLFU, 0)
+	require.NoError(t, err)
+
+	cache.Set("1", &models.Order{OrderUID: "1"})
+	cache.Set("1", &models.Order{OrderUID: "1", Entry: "updated"})
+
+	got, ok := cache.Get("1")
+	assert.True(t, ok)
+	assert.Equal(t, "updated", got.Entry)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestBoundedStorage_InvalidateAll(t *testing.T) {
+	cache, err := NewBoundedStorage(10, 0, PolicyLRU, 0)
+	require.NoError(t, err)
+	cache.Set("1", &models.Order{OrderUID: "1"})
+	cache.Set("2", &models.Order{OrderUID: "2"})
+
+	cache.Invalidate("1")
+	assert.Equal(t, 1, cache.Len())
+
+	cache.InvalidateAll()
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, int64(0), cache.Bytes())
+}
+
+func TestNewBoundedStorage_UnknownPolicy(t *testing.T) {
+	_, err := NewBoundedStorage(1, 0, "fifo", 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+)
+
+const benchKeys = 10_000
+
+// benchmarkMixed — конкурентная нагрузка, где writePercent процентов операций — Set, остальные — Get
+func benchmarkMixed(b *testing.B, cache Cache, writePercent int) {
+	uids := make([]string, benchKeys)
+	orders := make([]*models.Order, benchKeys)
+	for i := range uids {
+		uids[i] = fmt.Sprintf("order-%d", i)
+		orders[i] = &models.Order{OrderUID: uids[i]}
+		cache.Set(uids[i], orders[i])
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rnd := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			i := rnd.Intn(benchKeys)
+			if rnd.Intn(100) < writePercent {
+				cache.Set(uids[i], orders[i])
+			} else {
+				cache.Get(uids[i])
+			}
+		}
+	})
+}
+
+func BenchmarkCache_Mixed(b *testing.B) {
+	caches := []struct {
+		name string
+		new  func() Cache
+	}{
+		{"memory", func() Cache { return NewMemoryStorage() }},
+		{"bounded-lru", func() Cache {
+			c, _ := NewBoundedStorage(0, 0, PolicyLRU, 0)
+			return c
+		}},
+		{"sharded-lru", func() Cache {
+			c, _ := NewShardedStorage(4*runtime.GOMAXPROCS(0), 0, 0, PolicyLRU, 0)
+			return c
+		}},
+	}
+	for _, writePercent := range []int{1, 10, 50} {
+		for _, c := range caches {
+			b.Run(fmt.Sprintf("%s/writes=%d%%", c.name, writePercent), func(b *testing.B) {
+				benchmarkMixed(b, c.new(), writePercent)
+			})
+		}
+	}
+}
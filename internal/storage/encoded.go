@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"sync"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/pii"
+	"github.com/andybalholm/brotli"
+)
+
+// Encoded — готовое JSON-представление заказа для ответа HTTP и его сжатые варианты.
+// Сжатые и маскированные варианты строятся при первом обращении и переиспользуются.
+// Возвращаемые срезы общие для всех читателей, изменять их нельзя
+type Encoded struct {
+	json []byte
+	// заказ, из которого построен JSON; nil, если JSON получен готовым
+	order *models.Order
+
+	gzipOnce sync.Once
+	gzip     []byte
+
+	brotliOnce sync.Once
+	brotli     []byte
+
+	maskedMu sync.Mutex
+	masked   map[pii.MaskMode]*Encoded
+
+	// onCompress вызывается с размером построенного сжатого варианта, чтобы кэш учёл его в объёме
+	onCompress func(n int)
+}
+
+// кодирует заказ так же, как json.Encoder: JSON с переводом строки в конце
+func NewEncoded(order *models.Order) (*Encoded, error) {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return nil, err
+	}
+	enc := EncodedFromJSON(append(data, '\n'))
+	enc.order = order
+	return enc, nil
+}
+
+// оборачивает уже готовый JSON заказа
+func EncodedFromJSON(data []byte) *Encoded {
+	return &Encoded{json: data}
+}
+
+func (e *Encoded) JSON() []byte {
+	return e.json
+}
+
+// вариант, сжатый gzip; nil, если сжать не удалось
+func (e *Encoded) Gzip() []byte {
+	e.gzipOnce.Do(func() {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(e.json); err != nil {
+			return
+		}
+		if err := zw.Close(); err != nil {
+			return
+		}
+		e.gzip = buf.Bytes()
+		e.compressed(len(e.gzip))
+	})
+	return e.gzip
+}
+
+// вариант, сжатый brotli; nil, если сжать не удалось
+func (e *Encoded) Brotli() []byte {
+	e.brotliOnce.Do(func() {
+		var buf bytes.Buffer
+		bw := brotli.NewWriter(&buf)
+		if _, err := bw.Write(e.json); err != nil {
+			return
+		}
+		if err := bw.Close(); err != nil {
+			return
+		}
+		e.brotli = buf.Bytes()
+		e.compressed(len(e.brotli))
+	})
+	return e.brotli
+}
+
+// представление заказа с персональными данными, скрытыми по режиму mode; строится один раз на режим.
+// Его JSON и сжатые варианты учитываются в объёме кэша вместе с e
+func (e *Encoded) Masked(mode pii.MaskMode) (*Encoded, error) {
+	if mode == pii.MaskNone {
+		return e, nil
+	}
+	e.maskedMu.Lock()
+	defer e.maskedMu.Unlock()
+	if m, ok := e.masked[mode]; ok {
+		return m, nil
+	}
+	order := e.order
+	if order == nil {
+		order = new(models.Order)
+		if err := json.Unmarshal(e.json, order); err != nil {
+			return nil, err
+		}
+	}
+	m, err := NewEncoded(pii.MaskOrder(order, mode))
+	if err != nil {
+		return nil, err
+	}
+	m.onCompress = e.compressed
+	if e.masked == nil {
+		e.masked = make(map[pii.MaskMode]*Encoded)
+	}
+	e.masked[mode] = m
+	e.compressed(len(m.json))
+	return m, nil
+}
+
+func (e *Encoded) compressed(n int) {
+	if e.onCompress != nil {
+		e.onCompress(n)
+	}
+}
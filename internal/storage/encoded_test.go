@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/MikhaylovMaks/wb_techl0/internal/pii"
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoded_Variants(t *testing.T) {
+	order := &models.Order{OrderUID: "1", Items: []models.Items{{Name: "item"}}}
+	enc, err := NewEncoded(order)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, json.NewEncoder(&buf).Encode(order))
+	assert.Equal(t, buf.Bytes(), enc.JSON())
+
+	zr, err := gzip.NewReader(bytes.NewReader(enc.Gzip()))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, enc.JSON(), plain)
+
+	plain, err = io.ReadAll(brotli.NewReader(bytes.NewReader(enc.Brotli())))
+	require.NoError(t, err)
+	assert.Equal(t, enc.JSON(), plain)
+
+	// сжатые варианты строятся один раз
+	assert.Same(t, &enc.Gzip()[0], &enc.Gzip()[0])
+}
+
+func TestEncoded_Masked(t *testing.T) {
+	order := &models.Order{OrderUID: "1", Delivery: models.Delivery{Name: "Test Testov", Phone: "+9720000000"}}
+	enc, err := NewEncoded(order)
+	require.NoError(t, err)
+
+	same, err := enc.Masked(pii.MaskNone)
+	require.NoError(t, err)
+	assert.Same(t, enc, same)
+
+	masked, err := enc.Masked(pii.MaskFull)
+	require.NoError(t, err)
+	var got models.Order
+	require.NoError(t, json.Unmarshal(masked.JSON(), &got))
+	assert.Equal(t, pii.MaskOrder(order, pii.MaskFull), &got)
+	assert.NotContains(t, string(masked.JSON()), "Test Testov")
+
+	// вариант строится один раз на режим
+	again, err := enc.Masked(pii.MaskFull)
+	require.NoError(t, err)
+	assert.Same(t, masked, again)
+	partial, err := enc.Masked(pii.MaskPartial)
+	require.NoError(t, err)
+	assert.NotSame(t, masked, partial)
+
+	// готовый JSON без заказа, как из Redis, тоже маскируется
+	fromJSON, err := EncodedFromJSON(enc.JSON()).Masked(pii.MaskFull)
+	require.NoError(t, err)
+	assert.Equal(t, masked.JSON(), fromJSON.JSON())
+}
+
+func TestCache_GetEncodedFollowsSet(t *testing.T) {
+	for name, cache := range isolatingCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			cache.Set("1", &models.Order{OrderUID: "1", Entry: "first"})
+			enc, ok := cache.GetEncoded("1")
+			require.True(t, ok)
+			assert.Contains(t, string(enc.JSON()), `"entry":"first"`)
+
+			again, ok := cache.GetEncoded("1")
+			require.True(t, ok)
+			assert.Same(t, enc, again)
+
+			cache.Set("1", &models.Order{OrderUID: "1", Entry: "second"})
+			enc, ok = cache.GetEncoded("1")
+			require.True(t, ok)
+			assert.Contains(t, string(enc.JSON()), `"entry":"second"`)
+
+			cache.Invalidate("1")
+			_, ok = cache.GetEncoded("1")
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestRedisStorage_GetEncoded(t *testing.T) {
+	cache, _ := newTestRedis(t, 0)
+	cache.Set("1", &models.Order{OrderUID: "1", Entry: "redis"})
+
+	enc, ok := cache.GetEncoded("1")
+	require.True(t, ok)
+	var got models.Order
+	require.NoError(t, json.Unmarshal(enc.JSON(), &got))
+	assert.Equal(t, "redis", got.Entry)
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Invalidator — применяет к кэшу уведомления об изменении заказов в БД
+type Invalidator struct {
+	cache  Cache
+	loader Loader
+	log    *zap.SugaredLogger
+}
+
+// конструктор Invalidator; с loader закэшированные заказы перечитываются, без него — удаляются
+func NewInvalidator(cache Cache, loader Loader, log *zap.SugaredLogger) *Invalidator {
+	return &Invalidator{cache: cache, loader: loader, log: log}
+}
+
+// OrderChanged обрабатывает изменение заказа с номером changeSeq (change_seq в БД; 0 — неизвестен).
+// Изменения, которые закэшированная версия уже отражает, пропускаются. Пустой UID означает,
+// что изменения могли быть пропущены, и кэш очищается целиком
+func (i *Invalidator) OrderChanged(ctx context.Context, orderUID string, changeSeq int64) {
+	if orderUID == "" {
+		i.cache.InvalidateAll()
+		i.log.Warn("order changes may have been missed, cache cleared")
+		return
+	}
+	cached, ok := i.cache.Get(orderUID)
+	if !ok && i.loader != nil {
+		// заказы, которых нет в кэше, не загружаем
+		return
+	}
+	if ok && changeSeq > 0 && cached.ChangeSeq >= changeSeq {
+		i.log.Debugw("db change already cached, skipped", "order_uid", orderUID, "change_seq", changeSeq)
+		return
+	}
+	if i.loader == nil {
+		i.cache.Invalidate(orderUID)
+		i.log.Debugw("cached order invalidated by db change", "order_uid", orderUID)
+		return
+	}
+	loadCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	order, err := i.loader(loadCtx, orderUID)
+	cancel()
+	if err != nil {
+		// заказ удалён или недоступен — старую версию отдавать нельзя
+		i.cache.Invalidate(orderUID)
+		i.log.Debugw("cached order dropped after db change", "order_uid", orderUID, "err", err)
+		return
+	}
+	i.cache.Set(orderUID, order)
+	i.log.Debugw("cached order refreshed after db change", "order_uid", orderUID)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestInvalidator_InvalidateMode(t *testing.T) {
+	cache := NewMemoryStorage()
+	cache.Set("1", &models.Order{OrderUID: "1"})
+	cache.Set("2", &models.Order{OrderUID: "2"})
+
+	inv := NewInvalidator(cache, nil, zap.NewNop().Sugar())
+	inv.OrderChanged(context.Background(), "1", 0)
+
+	_, ok := cache.Get("1")
+	assert.False(t, ok)
+	_, ok = cache.Get("2")
+	assert.True(t, ok)
+
+	// пропущенные уведомления — сбрасываем всё
+	inv.OrderChanged(context.Background(), "", 0)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestInvalidator_RefreshMode(t *testing.T) {
+	cache := NewMemoryStorage()
+	cache.Set("1", &models.Order{OrderUID: "1", Entry: "old"})
+	cache.Set("gone", &models.Order{OrderUID: "gone"})
+
+	var loads []string
+	loader := func(_ context.Context, uid string) (*models.Order, error) {
+		loads = append(loads, uid)
+		if uid == "gone" {
+			return nil, errors.New("not found")
+		}
+		return &models.Order{OrderUID: uid, Entry: "new"}, nil
+	}
+	inv := NewInvalidator(cache, loader, zap.NewNop().Sugar())
+
+	inv.OrderChanged(context.Background(), "1", 0)
+	got, ok := cache.Get("1")
+	require.True(t, ok)
+	assert.Equal(t, "new", got.Entry)
+
+	inv.OrderChanged(context.Background(), "gone", 0)
+	_, ok = cache.Get("gone")
+	assert.False(t, ok)
+
+	// не закэшированные заказы не загружаются
+	inv.OrderChanged(context.Background(), "other", 0)
+	_, ok = cache.Get("other")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"1", "gone"}, loads)
+}
+
+// уведомления об изменениях, которые закэшированная версия уже отражает, пропускаются
+func TestInvalidator_SkipsSeenChanges(t *testing.T) {
+	cache := NewMemoryStorage()
+	cache.Set("1", &models.Order{OrderUID: "1", Entry: "old", ChangeSeq: 5})
+
+	var loads int
+	loader := func(_ context.Context, uid string) (*models.Order, error) {
+		loads++
+		// одна транзакция изменила заказ трижды: загружена версия после всех изменений
+		return &models.Order{OrderUID: uid, Entry: "new", ChangeSeq: 8}, nil
+	}
+	inv := NewInvalidator(cache, loader, zap.NewNop().Sugar())
+
+	inv.OrderChanged(context.Background(), "1", 4)
+	inv.OrderChanged(context.Background(), "1", 5)
+	assert.Equal(t, 0, loads)
+
+	for _, seq := range []int64{6, 7, 8} {
+		inv.OrderChanged(context.Background(), "1", seq)
+	}
+	assert.Equal(t, 1, loads)
+	got, ok := cache.Get("1")
+	require.True(t, ok)
+	assert.Equal(t, "new", got.Entry)
+
+	// номер неизвестен — заказ перечитывается
+	inv.OrderChanged(context.Background(), "1", 0)
+	assert.Equal(t, 2, loads)
+
+	// в режиме invalidate старое уведомление не сбрасывает свежую запись
+	inv = NewInvalidator(cache, nil, zap.NewNop().Sugar())
+	inv.OrderChanged(context.Background(), "1", 7)
+	_, ok = cache.Get("1")
+	assert.True(t, ok)
+	inv.OrderChanged(context.Background(), "1", 9)
+	_, ok = cache.Get("1")
+	assert.False(t, ok)
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/faker"
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// локальные реализации кэша, которые обязаны изолировать значения
+func isolatingCaches(t testing.TB) map[string]Cache {
+	bounded, err := NewBoundedStorage(100, 0, PolicyLFU, 0)
+	require.NoError(t, err)
+	sharded, err := NewShardedStorage(4, 0, 0, PolicyLRU, 0)
+	require.NoError(t, err)
+	return map[string]Cache{
+		"memory":  NewMemoryStorage(),
+		"bounded": bounded,
+		"sharded": sharded,
+	}
+}
+
+func TestCache_MutatingValuesDoesNotAffectCache(t *testing.T) {
+	for name, cache := range isolatingCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			order := &models.Order{OrderUID: "1", Items: []models.Items{{Name: "orig"}}}
+			cache.Set("1", order)
+
+			// изменение переданного в Set заказа
+			order.Items[0].Name = "changed after set"
+			order.Delivery.Name = "changed after set"
+
+			got, ok := cache.Get("1")
+			require.True(t, ok)
+			assert.Equal(t, "orig", got.Items[0].Name)
+			assert.Empty(t, got.Delivery.Name)
+
+			// изменение полученного из Get заказа
+			got.Items[0].Name = "changed after get"
+			got.Items = nil
+
+			again, ok := cache.Get("1")
+			require.True(t, ok)
+			require.Len(t, again.Items, 1)
+			assert.Equal(t, "orig", again.Items[0].Name)
+		})
+	}
+}
+
+// под -race тест падает, если читатели получают общий экземпляр заказа
+func TestCache_ConcurrentReadersCannotObserveMutations(t *testing.T) {
+	for name, cache := range isolatingCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			cache.Set("1", &models.Order{OrderUID: "1", Items: []models.Items{{Name: "orig", Price: 1}}})
+
+			var wg sync.WaitGroup
+			errs := make(chan string, 16)
+			for w := 0; w < 8; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < 200; i++ {
+						got, ok := cache.Get("1")
+						if !ok {
+							errs <- "order disappeared"
+							return
+						}
+						if got.Items[0].Name != "orig" || got.Items[0].Price != 1 {
+							errs <- fmt.Sprintf("observed mutation: %+v", got.Items[0])
+							return
+						}
+						got.Items[0].Name = fmt.Sprintf("reader-%d", w)
+						got.Items[0].Price = w + 100
+						got.OrderUID = "mutated"
+					}
+				}(w)
+			}
+			wg.Wait()
+			close(errs)
+			for e := range errs {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+// стоимость копирования на чтении и записи для заказа реалистичного размера
+func BenchmarkCache_IsolatedGetSet(b *testing.B) {
+	order := faker.GenerateFakeOrder()
+	for name, cache := range isolatingCaches(b) {
+		cache.Set(order.OrderUID, order)
+		b.Run(name+"/get", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				cache.Get(order.OrderUID)
+			}
+		})
+		b.Run(name+"/set", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				cache.Set(order.OrderUID, order)
+			}
+		})
+	}
+}
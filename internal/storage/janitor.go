@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"go.uber.org/zap"
+)
+
+// Expirable — кэш, записи которого могут истекать
+type Expirable interface {
+	Cache
+	DeleteExpired() int
+	ExpiringSoon(within time.Duration) []string
+}
+
+// Loader — источник актуальной версии заказа (обычно OrderRepository.GetOrderByUID)
+type Loader func(ctx context.Context, orderUID string) (*models.Order, error)
+
+// Janitor — фоновая очистка просроченных записей и упреждающее обновление горячих
+type Janitor struct {
+	cache        Expirable
+	interval     time.Duration
+	refreshAhead time.Duration
+	loader       Loader
+	log          *zap.SugaredLogger
+}
+
+// конструктор Janitor; interval должен быть больше нуля. При refreshAhead == 0 или loader == nil записи только удаляются
+func NewJanitor(cache Expirable, interval, refreshAhead time.Duration, loader Loader, log *zap.SugaredLogger) *Janitor {
+	return &Janitor{
+		cache:        cache,
+		interval:     interval,
+		refreshAhead: refreshAhead,
+		loader:       loader,
+		log:          log,
+	}
+}
+
+// запускает периодическую очистку до отмены контекста
+func (j *Janitor) Start(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	j.log.Infow("cache janitor started", "interval", j.interval, "refresh_ahead", j.refreshAhead)
+
+	for {
+		select {
+		case <-ctx.Done():
+			j.log.Info("cache janitor stopped")
+			return
+		case <-ticker.C:
+			j.runOnce(ctx)
+		}
+	}
+}
+
+func (j *Janitor) runOnce(ctx context.Context) {
+	if j.refreshAhead > 0 && j.loader != nil {
+		j.refresh(ctx)
+	}
+	if n := j.cache.DeleteExpired(); n > 0 {
+		j.log.Debugw("expired orders removed from cache", "count", n)
+	}
+}
+
+// перечитывает горячие записи, срок которых скоро истечёт
+func (j *Janitor) refresh(ctx context.Context) {
+	for _, uid := range j.cache.ExpiringSoon(j.refreshAhead) {
+		if ctx.Err() != nil {
+			return
+		}
+		loadCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		order, err := j.loader(loadCtx, uid)
+		cancel()
+		if err != nil {
+			// запись доживёт до своего срока и будет удалена
+			j.log.Warnw("failed to refresh cached order", "order_uid", uid, "err", err)
+			continue
+		}
+		j.cache.Set(uid, order)
+	}
+}
+
+// expiresAt — момент истечения для ttl; нулевое время означает бессрочную запись
+func expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func expired(at, now time.Time) bool {
+	return !at.IsZero() && now.After(at)
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestJanitor_RemovesExpiredEntries(t *testing.T) {
+	cache, err := NewBoundedStorage(10, 0, PolicyLRU, 10*time.Millisecond)
+	require.NoError(t, err)
+	cache.Set("1", &models.Order{OrderUID: "1"})
+	cache.SetWithTTL("2", &models.Order{OrderUID: "2"}, time.Hour)
+
+	j := NewJanitor(cache, 5*time.Millisecond, 0, nil, zap.NewNop().Sugar())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		j.Start(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return cache.Len() == 1 }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("janitor did not stop after context cancellation")
+	}
+}
+
+func TestJanitor_RefreshAheadReloadsHotEntries(t *testing.T) {
+	cache := NewMemoryStorageWithTTL(50 * time.Millisecond)
+	cache.Set("hot", &models.Order{OrderUID: "hot"})
+	cache.Set("cold", &models.Order{OrderUID: "cold"})
+	cache.Get("hot")
+
+	var mu sync.Mutex
+	var loaded []string
+	loader := func(ctx context.Context, uid string) (*models.Order, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		loaded = append(loaded, uid)
+		return &models.Order{OrderUID: uid, Entry: "fresh"}, nil
+	}
+
+	j := NewJanitor(cache, time.Hour, time.Minute, loader, zap.NewNop().Sugar())
+	j.runOnce(context.Background())
+
+	assert.Equal(t, []string{"hot"}, loaded)
+	// после обновления запись снова холодная до следующего обращения
+	assert.Empty(t, cache.ExpiringSoon(time.Minute))
+
+	got, ok := cache.Get("hot")
+	require.True(t, ok)
+	assert.Equal(t, "fresh", got.Entry)
+}
+
+func TestJanitor_RefreshErrorKeepsEntry(t *testing.T) {
+	cache := NewMemoryStorageWithTTL(time.Hour)
+	cache.Set("1", &models.Order{OrderUID: "1"})
+	cache.Get("1")
+
+	loader := func(ctx context.Context, uid string) (*models.Order, error) {
+		return nil, errors.New("db unavailable")
+	}
+	j := NewJanitor(cache, time.Hour, 2*time.Hour, loader, zap.NewNop().Sugar())
+	j.runOnce(context.Background())
+
+	_, ok := cache.Get("1")
+	assert.True(t, ok)
+}
@@ -2,25 +2,48 @@ package storage
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/MikhaylovMaks/wb_techl0/internal/models"
 )
 
 type Cache interface {
 	Get(orderUID string) (*models.Order, bool)
+	// GetEncoded — готовое JSON-представление заказа для отдачи клиенту
+	GetEncoded(orderUID string) (*Encoded, bool)
 	Set(orderUID string, order *models.Order)
+	// SetWithTTL — как Set, но со своим сроком жизни записи (0 — без срока)
+	SetWithTTL(orderUID string, order *models.Order, ttl time.Duration)
 	Invalidate(orderUID string)
 	InvalidateAll()
 }
 
+// MemoryStorage хранит собственные копии заказов: Set и Get копируют значение,
+// поэтому изменения у вызывающего не видны другим читателям кэша
 type MemoryStorage struct {
-	mu     sync.RWMutex
-	orders map[string]*models.Order
+	mu         sync.RWMutex
+	orders     map[string]*memoryEntry
+	defaultTTL time.Duration
+	expired    uint64
+}
+
+type memoryEntry struct {
+	order     *models.Order
+	expiresAt time.Time
+	accessed  atomic.Bool
+	encoded   atomic.Pointer[Encoded]
 }
 
 func NewMemoryStorage() *MemoryStorage {
+	return NewMemoryStorageWithTTL(0)
+}
+
+// конструктор кэша, записи которого живут defaultTTL (0 — бессрочно)
+func NewMemoryStorageWithTTL(defaultTTL time.Duration) *MemoryStorage {
 	return &MemoryStorage{
-		orders: make(map[string]*models.Order),
+		orders:     make(map[string]*memoryEntry),
+		defaultTTL: defaultTTL,
 	}
 }
 
@@ -28,15 +51,47 @@ func NewMemoryStorage() *MemoryStorage {
 func (s *MemoryStorage) Get(orderUID string) (*models.Order, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	order, ok := s.orders[orderUID]
-	return order, ok
+	e, ok := s.orders[orderUID]
+	if !ok || expired(e.expiresAt, time.Now()) {
+		return nil, false
+	}
+	e.accessed.Store(true)
+	return e.order.Clone(), true
+}
+
+// готовое JSON-представление заказа; строится при первом запросе и хранится вместе с записью
+func (s *MemoryStorage) GetEncoded(orderUID string) (*Encoded, bool) {
+	s.mu.RLock()
+	e, ok := s.orders[orderUID]
+	s.mu.RUnlock()
+	if !ok || expired(e.expiresAt, time.Now()) {
+		return nil, false
+	}
+	e.accessed.Store(true)
+	if enc := e.encoded.Load(); enc != nil {
+		return enc, true
+	}
+	// заказ в записи не меняется после Set, поэтому кодируем без блокировки
+	enc, err := NewEncoded(e.order)
+	if err != nil {
+		return nil, false
+	}
+	if !e.encoded.CompareAndSwap(nil, enc) {
+		enc = e.encoded.Load()
+	}
+	return enc, true
 }
 
 // добавление или обновление заказа в кэше
 func (s *MemoryStorage) Set(orderUID string, order *models.Order) {
+	s.SetWithTTL(orderUID, order, s.defaultTTL)
+}
+
+// добавление или обновление заказа с собственным сроком жизни
+func (s *MemoryStorage) SetWithTTL(orderUID string, order *models.Order, ttl time.Duration) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.orders[orderUID] = order
+	s.orders[orderUID] = &memoryEntry{order: order.Clone(), expiresAt: expiresAt(ttl)}
 }
 
 // удаление конкретного заказа из кэша
@@ -50,5 +105,65 @@ func (s *MemoryStorage) Invalidate(orderUID string) {
 func (s *MemoryStorage) InvalidateAll() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.orders = make(map[string]*models.Order)
+	s.orders = make(map[string]*memoryEntry)
+}
+
+// удаляет просроченные записи и возвращает их количество
+func (s *MemoryStorage) DeleteExpired() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var n int
+	for uid, e := range s.orders {
+		if expired(e.expiresAt, now) {
+			delete(s.orders, uid)
+			n++
+		}
+	}
+	s.expired += uint64(n)
+	return n
+}
+
+// возвращает UID запрошенных после последней записи заказов, срок которых истекает в течение within
+func (s *MemoryStorage) ExpiringSoon(within time.Duration) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	deadline := time.Now().Add(within)
+	var uids []string
+	for uid, e := range s.orders {
+		if !e.expiresAt.IsZero() && e.expiresAt.Before(deadline) && e.accessed.Load() {
+			uids = append(uids, uid)
+		}
+	}
+	return uids
+}
+
+// обходит действующие записи под блокировкой чтения; fn возвращает false, чтобы остановить обход.
+// fn получает сам закэшированный заказ и не должна его изменять
+func (s *MemoryStorage) Range(fn func(orderUID string, order *models.Order) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	for uid, e := range s.orders {
+		if expired(e.expiresAt, now) {
+			continue
+		}
+		if !fn(uid, e.order) {
+			return
+		}
+	}
+}
+
+// количество записей в кэше, включая ещё не удалённые просроченные
+func (s *MemoryStorage) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.orders)
+}
+
+// MemoryStorage не ограничена по размеру, поэтому записи удаляются только по истечении срока
+func (s *MemoryStorage) EvictionStats() (evicted, expired uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return 0, s.expired
 }
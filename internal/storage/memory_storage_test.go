@@ -2,6 +2,7 @@ package storage
 
 import (
 	"testing"
+	"time"
 
 	"github.com/MikhaylovMaks/wb_techl0/internal/models"
 	"github.com/stretchr/testify/assert"
@@ -39,3 +40,22 @@ func TestMemoryStorage_InvalidateAll(t *testing.T) {
 	assert.False(t, ok1)
 	assert.False(t, ok2)
 }
+
+func TestMemoryStorage_TTL(t *testing.T) {
+	cache := NewMemoryStorageWithTTL(20 * time.Millisecond)
+	cache.Set("short", &models.Order{OrderUID: "short"})
+	cache.SetWithTTL("long", &models.Order{OrderUID: "long"}, time.Hour)
+	cache.SetWithTTL("forever", &models.Order{OrderUID: "forever"}, 0)
+
+	time.Sleep(40 * time.Millisecond)
+
+	_, okShort := cache.Get("short")
+	_, okLong := cache.Get("long")
+	_, okForever := cache.Get("forever")
+	assert.False(t, okShort)
+	assert.True(t, okLong)
+	assert.True(t, okForever)
+
+	assert.Equal(t, 1, cache.DeleteExpired())
+	assert.Equal(t, 0, cache.DeleteExpired())
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// верхняя граница числа запоминаемых отсутствующих UID
+const negativeMaxEntries = 10_000
+
+// NegativeCache — короткоживущий список UID, которых нет в БД,
+// чтобы повторные запросы несуществующих заказов не доходили до базы
+type NegativeCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]time.Time
+}
+
+// конструктор NegativeCache; при ttl <= 0 кэш ничего не запоминает
+func NewNegativeCache(ttl time.Duration) *NegativeCache {
+	return &NegativeCache{
+		ttl:     ttl,
+		entries: make(map[string]time.Time),
+	}
+}
+
+// запоминает, что заказа с таким UID нет
+func (c *NegativeCache) Add(orderUID string) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= negativeMaxEntries {
+		c.deleteExpired(now)
+		if len(c.entries) >= negativeMaxEntries {
+			c.entries = make(map[string]time.Time)
+		}
+	}
+	c.entries[orderUID] = now.Add(c.ttl)
+}
+
+// проверяет, известно ли, что заказа с таким UID нет
+func (c *NegativeCache) Contains(orderUID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	at, ok := c.entries[orderUID]
+	if !ok {
+		return false
+	}
+	if expired(at, time.Now()) {
+		delete(c.entries, orderUID)
+		return false
+	}
+	return true
+}
+
+// забывает UID, например, когда заказ появился
+func (c *NegativeCache) Remove(orderUID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, orderUID)
+}
+
+func (c *NegativeCache) deleteExpired(now time.Time) {
+	for uid, at := range c.entries {
+		if expired(at, now) {
+			delete(c.entries, uid)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// максимальное время одной операции с Redis: кэш не должен тормозить запросы
+const redisOpTimeout = 500 * time.Millisecond
+
+// RedisStorage — общий для всех реплик кэш в Redis (или совместимом по RESP хранилище);
+// заказы хранятся в JSON, срок жизни записей отслеживает сам Redis
+type RedisStorage struct {
+	client     redis.UniversalClient
+	prefix     string
+	channel    string
+	defaultTTL time.Duration
+	log        *zap.SugaredLogger
+}
+
+// событие инвалидации, разосланное одной из реплик
+type Invalidation struct {
+	Origin   string
+	OrderUID string // пустой UID означает очистку всего кэша
+}
+
+// конструктор RedisStorage; ключи заказов получают префикс prefix,
+// события инвалидации публикуются в канал prefix + "invalidate"
+func NewRedisStorage(client redis.UniversalClient, prefix string, defaultTTL time.Duration, log *zap.SugaredLogger) *RedisStorage {
+	return &RedisStorage{
+		client:     client,
+		prefix:     prefix,
+		channel:    prefix + "invalidate",
+		defaultTTL: defaultTTL,
+		log:        log,
+	}
+}
+
+func (s *RedisStorage) key(orderUID string) string {
+	return s.prefix + "order:" + orderUID
+}
+
+// получение заказа из кэша; ошибки Redis считаются промахом
+func (s *RedisStorage) Get(orderUID string) (*models.Order, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	data, err := s.client.Get(ctx, s.key(orderUID)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			s.log.Warnw("redis get failed", "order_uid", orderUID, "err", err)
+		}
+		return nil, false
+	}
+	var order models.Order
+	if err := json.Unmarshal(data, &order); err != nil {
+		s.log.Warnw("redis value is not a valid order", "order_uid", orderUID, "err", err)
+		return nil, false
+	}
+	return &order, true
+}
+
+// JSON заказа отдаётся как есть, без разбора в структуру
+func (s *RedisStorage) GetEncoded(orderUID string) (*Encoded, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	data, err := s.client.Get(ctx, s.key(orderUID)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			s.log.Warnw("redis get failed", "order_uid", orderUID, "err", err)
+		}
+		return nil, false
+	}
+	return EncodedFromJSON(append(data, '\n')), true
+}
+
+// добавление или обновление заказа в кэше
+func (s *RedisStorage) Set(orderUID string, order *models.Order) {
+	s.SetWithTTL(orderUID, order, s.defaultTTL)
+}
+
+// добавление или обновление заказа с собственным сроком жизни
+func (s *RedisStorage) SetWithTTL(orderUID string, order *models.Order, ttl time.Duration) {
+	data, err := json.Marshal(order)
+	if err != nil {
+		s.log.Errorw("failed to marshal order for redis", "order_uid", orderUID, "err", err)
+		return
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := s.client.Set(ctx, s.key(orderUID), data, ttl).Err(); err != nil {
+		s.log.Warnw("redis set failed", "order_uid", orderUID, "err", err)
+	}
+}
+
+// удаление конкретного заказа из кэша
+func (s *RedisStorage) Invalidate(orderUID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := s.client.Del(ctx, s.key(orderUID)).Err(); err != nil {
+		s.log.Warnw("redis del failed", "order_uid", orderUID, "err", err)
+	}
+}
+
+// очистка всех заказов с нашим префиксом; остальные ключи базы не затрагиваются
+func (s *RedisStorage) InvalidateAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*redisOpTimeout)
+	defer cancel()
+
+	iter := s.client.Scan(ctx, 0, s.key("*"), 500).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == 500 {
+			s.del(ctx, keys)
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		s.log.Warnw("redis scan failed", "err", err)
+	}
+	s.del(ctx, keys)
+}
+
+func (s *RedisStorage) del(ctx context.Context, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	if err := s.client.Del(ctx, keys...).Err(); err != nil {
+		s.log.Warnw("redis del failed", "keys", len(keys), "err", err)
+	}
+}
+
+// рассылает другим репликам событие инвалидации
+func (s *RedisStorage) PublishInvalidation(origin, orderUID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := s.client.Publish(ctx, s.channel, origin+" "+orderUID).Err(); err != nil {
+		s.log.Warnw("redis publish failed", "order_uid", orderUID, "err", err)
+	}
+}
+
+// подписка на события инвалидации; канал закрывается при отмене контекста
+func (s *RedisStorage) Invalidations(ctx context.Context) (<-chan Invalidation, error) {
+	sub := s.client.Subscribe(ctx, s.channel)
+	// дожидаемся подтверждения подписки, чтобы не потерять первые события
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	out := make(chan Invalidation)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+		msgs := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				origin, uid, _ := strings.Cut(msg.Payload, " ")
+				select {
+				case out <- Invalidation{Origin: origin, OrderUID: uid}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
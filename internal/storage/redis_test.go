@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestRedis(t *testing.T, ttl time.Duration) (*RedisStorage, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStorage(client, "test:", ttl, zap.NewNop().Sugar()), mr
+}
+
+func TestRedisStorage_SetGet(t *testing.T) {
+	cache, _ := newTestRedis(t, 0)
+	order := &models.Order{
+		OrderUID: "123",
+		Delivery: models.Delivery{Name: "Test"},
+		Items:    []models.Items{{ChrtID: 1, Name: "item"}},
+	}
+
+	cache.Set("123", order)
+
+	got, ok := cache.Get("123")
+	require.True(t, ok)
+	assert.Equal(t, order, got)
+
+	_, ok = cache.Get("missing")
+	assert.False(t, ok)
+}
+
+func TestRedisStorage_TTL(t *testing.T) {
+	cache, mr := newTestRedis(t, time.Minute)
+	cache.Set("default", &models.Order{OrderUID: "default"})
+	cache.SetWithTTL("long", &models.Order{OrderUID: "long"}, time.Hour)
+
+	assert.Equal(t, time.Minute, mr.TTL("test:order:default"))
+
+	mr.FastForward(2 * time.Minute)
+	_, okDefault := cache.Get("default")
+	_, okLong := cache.Get("long")
+	assert.False(t, okDefault)
+	assert.True(t, okLong)
+}
+
+func TestRedisStorage_InvalidateAllKeepsForeignKeys(t *testing.T) {
+	cache, mr := newTestRedis(t, 0)
+	require.NoError(t, mr.Set("other:key", "value"))
+	cache.Set("1", &models.Order{OrderUID: "1"})
+	cache.Set("2", &models.Order{OrderUID: "2"})
+
+	cache.Invalidate("1")
+	_, ok := cache.Get("1")
+	assert.False(t, ok)
+
+	cache.InvalidateAll()
+	_, ok = cache.Get("2")
+	assert.False(t, ok)
+	assert.True(t, mr.Exists("other:key"))
+}
+
+func TestRedisStorage_UnavailableIsMiss(t *testing.T) {
+	cache, mr := newTestRedis(t, 0)
+	cache.Set("1", &models.Order{OrderUID: "1"})
+	mr.Close()
+
+	_, ok := cache.Get("1")
+	assert.False(t, ok)
+}
+
+func TestTieredStorage_InvalidationReachesOtherReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	newReplica := func() (*TieredStorage, *MemoryStorage) {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		local := NewMemoryStorage()
+		remote := NewRedisStorage(client, "test:", 0, zap.NewNop().Sugar())
+		return NewTieredStorage(local, remote, zap.NewNop().Sugar()), local
+	}
+	a, _ := newReplica()
+	b, bLocal := newReplica()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Start(ctx)
+
+	a.Set("1", &models.Order{OrderUID: "1"})
+
+	// вторая реплика берёт заказ из Redis и запоминает локально
+	got, ok := b.Get("1")
+	require.True(t, ok)
+	assert.Equal(t, "1", got.OrderUID)
+	_, ok = bLocal.Get("1")
+	require.True(t, ok)
+
+	assert.Eventually(t, func() bool {
+		a.Invalidate("1")
+		_, ok := bLocal.Get("1")
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTieredStorage_RetriesSubscription(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	local := NewMemoryStorage()
+	b := NewTieredStorage(local, NewRedisStorage(client, "test:", 0, zap.NewNop().Sugar()), zap.NewNop().Sugar())
+	b.minBackoff, b.maxBackoff = 5*time.Millisecond, 20*time.Millisecond
+	local.Set("1", &models.Order{OrderUID: "1"})
+
+	// Redis недоступен при запуске реплики
+	mr.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Start(ctx)
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, mr.Restart())
+
+	// после подписки локальный уровень очищен: события за время сбоя потеряны
+	assert.Eventually(t, func() bool {
+		_, ok := local.Get("1")
+		return !ok
+	}, time.Second, 5*time.Millisecond)
+
+	local.Set("2", &models.Order{OrderUID: "2"})
+	assert.Eventually(t, func() bool {
+		b.remote.PublishInvalidation("other", "2")
+		_, ok := local.Get("2")
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"fmt"
+	"hash/maphash"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+)
+
+// кэш, разбитый на независимые сегменты со своими блокировками;
+// лимиты делятся между сегментами поровну, поэтому соблюдаются приблизительно
+type ShardedStorage struct {
+	seed   maphash.Seed
+	shards []*BoundedStorage
+}
+
+// конструктор шардированного кэша
+func NewShardedStorage(shards, maxEntries int, maxBytes int64, policy EvictionPolicy, defaultTTL time.Duration) (*ShardedStorage, error) {
+	if shards <= 0 {
+		return nil, fmt.Errorf("shard count must be positive, got %d", shards)
+	}
+	s := &ShardedStorage{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*BoundedStorage, shards),
+	}
+	for i := range s.shards {
+		shard, err := NewBoundedStorage(ceilDiv(maxEntries, shards), ceilDiv(maxBytes, int64(shards)), policy, defaultTTL)
+		if err != nil {
+			return nil, err
+		}
+		s.shards[i] = shard
+	}
+	return s, nil
+}
+
+func (s *ShardedStorage) shard(orderUID string) *BoundedStorage {
+	return s.shards[maphash.String(s.seed, orderUID)%uint64(len(s.shards))]
+}
+
+// получение заказа из кэша
+func (s *ShardedStorage) Get(orderUID string) (*models.Order, bool) {
+	return s.shard(orderUID).Get(orderUID)
+}
+
+// готовое JSON-представление заказа
+func (s *ShardedStorage) GetEncoded(orderUID string) (*Encoded, bool) {
+	return s.shard(orderUID).GetEncoded(orderUID)
+}
+
+// добавление или обновление заказа в кэше
+func (s *ShardedStorage) Set(orderUID string, order *models.Order) {
+	s.shard(orderUID).Set(orderUID, order)
+}
+
+// добавление или обновление заказа с собственным сроком жизни
+func (s *ShardedStorage) SetWithTTL(orderUID string, order *models.Order, ttl time.Duration) {
+	s.shard(orderUID).SetWithTTL(orderUID, order, ttl)
+}
+
+// удаление конкретного заказа из кэша
+func (s *ShardedStorage) Invalidate(orderUID string) {
+	s.shard(orderUID).Invalidate(orderUID)
+}
+
+// очистка всего кэша
+func (s *ShardedStorage) InvalidateAll() {
+	for _, shard := range s.shards {
+		shard.InvalidateAll()
+	}
+}
+
+// удаляет просроченные записи во всех сегментах
+func (s *ShardedStorage) DeleteExpired() int {
+	var n int
+	for _, shard := range s.shards {
+		n += shard.DeleteExpired()
+	}
+	return n
+}
+
+// возвращает UID горячих записей, срок которых истекает в течение within
+func (s *ShardedStorage) ExpiringSoon(within time.Duration) []string {
+	var uids []string
+	for _, shard := range s.shards {
+		uids = append(uids, shard.ExpiringSoon(within)...)
+	}
+	return uids
+}
+
+// обходит действующие записи сегмент за сегментом
+func (s *ShardedStorage) Range(fn func(orderUID string, order *models.Order) bool) {
+	stopped := false
+	for _, shard := range s.shards {
+		shard.Range(func(orderUID string, order *models.Order) bool {
+			stopped = !fn(orderUID, order)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// количество записей во всех сегментах
+func (s *ShardedStorage) Len() int {
+	var n int
+	for _, shard := range s.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// примерный объём закэшированных заказов в байтах
+func (s *ShardedStorage) Bytes() int64 {
+	var n int64
+	for _, shard := range s.shards {
+		n += shard.Bytes()
+	}
+	return n
+}
+
+// суммарная статистика вытеснения по всем сегментам
+func (s *ShardedStorage) EvictionStats() (evicted, expired uint64) {
+	for _, shard := range s.shards {
+		ev, ex := shard.EvictionStats()
+		evicted += ev
+		expired += ex
+	}
+	return evicted, expired
+}
+
+func ceilDiv[T int | int64](a, b T) T {
+	return (a + b - 1) / b
+}
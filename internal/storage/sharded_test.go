@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedStorage_SetGetInvalidate(t *testing.T) {
+	cache, err := NewShardedStorage(4, 0, 0, PolicyLRU, 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		uid := fmt.Sprintf("uid-%d", i)
+		cache.Set(uid, &models.Order{OrderUID: uid})
+	}
+	assert.Equal(t, 100, cache.Len())
+
+	got, ok := cache.Get("uid-42")
+	assert.True(t, ok)
+	assert.Equal(t, "uid-42", got.OrderUID)
+
+	cache.Invalidate("uid-42")
+	_, ok = cache.Get("uid-42")
+	assert.False(t, ok)
+
+	cache.InvalidateAll()
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestShardedStorage_LimitsSplitAcrossShards(t *testing.T) {
+	cache, err := NewShardedStorage(4, 8, 0, PolicyLRU, 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 1000; i++ {
+		uid := fmt.Sprintf("uid-%d", i)
+		cache.Set(uid, &models.Order{OrderUID: uid})
+	}
+	assert.LessOrEqual(t, cache.Len(), 8)
+}
+
+func TestShardedStorage_Concurrent(t *testing.T) {
+	cache, err := NewShardedStorage(8, 0, 0, PolicyLFU, 0)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				uid := fmt.Sprintf("uid-%d", i%50)
+				if i%3 == 0 {
+					cache.Set(uid, &models.Order{OrderUID: uid})
+				} else {
+					cache.Get(uid)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	assert.Equal(t, 50, cache.Len())
+}
+
+func TestNewShardedStorage_InvalidShardCount(t *testing.T) {
+	_, err := NewShardedStorage(0, 0, 0, PolicyLRU, 0)
+	assert.Error(t, err)
+}
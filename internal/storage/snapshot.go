@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+)
+
+// версия формата файла снимка; снимки прежних версий не читаются, и кэш прогревается заново
+const snapshotVersion = 3
+
+// Ranger — кэш, содержимое которого можно обойти, например, чтобы сохранить снимок
+type Ranger interface {
+	Range(fn func(orderUID string, order *models.Order) bool)
+}
+
+type snapshotHeader struct {
+	Version   int
+	HighWater int64
+	CreatedAt time.Time
+}
+
+type snapshotRecord struct {
+	OrderUID string
+	Order    models.Order
+}
+
+// WriteSnapshot — сохраняет содержимое кэша в сжатый файл вместе с отметкой highWater
+// (отметка изменений заказов в БД на момент снимка, см. OrderRepository.ChangeWatermark). Файл заменяется атомарно
+func WriteSnapshot(path string, cache Ranger, highWater int64) (int, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, fmt.Errorf("create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	enc := gob.NewEncoder(zw)
+	if err := enc.Encode(snapshotHeader{Version: snapshotVersion, HighWater: highWater, CreatedAt: time.Now()}); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("write snapshot header: %w", err)
+	}
+
+	var n int
+	var encErr error
+	cache.Range(func(orderUID string, order *models.Order) bool {
+		if order == nil {
+			return true
+		}
+		if encErr = enc.Encode(snapshotRecord{OrderUID: orderUID, Order: *order}); encErr != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if encErr != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("write snapshot record: %w", encErr)
+	}
+
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("flush snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("close snapshot file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("replace snapshot file: %w", err)
+	}
+	return n, nil
+}
+
+// ReadSnapshot — читает снимок и передаёт каждый заказ в fn; возвращает отметку highWater.
+// Если файла нет, возвращается ошибка, для которой errors.Is(err, os.ErrNotExist)
+func ReadSnapshot(path string, fn func(orderUID string, order *models.Order)) (int64, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("open snapshot: %w", err)
+	}
+	defer zr.Close()
+
+	dec := gob.NewDecoder(zr)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return 0, 0, fmt.Errorf("read snapshot header: %w", err)
+	}
+	if header.Version != snapshotVersion {
+		return 0, 0, fmt.Errorf("unsupported snapshot version %d", header.Version)
+	}
+
+	var n int
+	for {
+		var rec snapshotRecord
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, n, fmt.Errorf("read snapshot record: %w", err)
+		}
+		order := rec.Order
+		fn(rec.OrderUID, &order)
+		n++
+	}
+	return header.HighWater, n, nil
+}
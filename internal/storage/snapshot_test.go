@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	src := NewMemoryStorage()
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	src.Set("1", &models.Order{
+		OrderUID:    "1",
+		DateCreated: created,
+		Delivery:    models.Delivery{Name: "Test"},
+		Items:       []models.Items{{ChrtID: 1, Name: "item"}},
+	})
+	src.Set("2", &models.Order{OrderUID: "2", DateCreated: created})
+
+	n, err := WriteSnapshot(path, src, 42)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	dst := NewMemoryStorage()
+	highWater, restored, err := ReadSnapshot(path, dst.Set)
+	require.NoError(t, err)
+	assert.Equal(t, 2, restored)
+	assert.Equal(t, int64(42), highWater)
+
+	want, _ := src.Get("1")
+	got, ok := dst.Get("1")
+	require.True(t, ok)
+	assert.Equal(t, want.Delivery, got.Delivery)
+	assert.Equal(t, want.Items, got.Items)
+	assert.True(t, want.DateCreated.Equal(got.DateCreated))
+}
+
+func TestSnapshot_Missing(t *testing.T) {
+	_, _, err := ReadSnapshot(filepath.Join(t.TempDir(), "none"), func(string, *models.Order) {})
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestSnapshot_Corrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	require.NoError(t, os.WriteFile(path, []byte("not a snapshot"), 0o600))
+
+	_, _, err := ReadSnapshot(path, func(string, *models.Order) {})
+	assert.Error(t, err)
+}
+
+func TestSnapshot_ShardedStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	src, err := NewShardedStorage(4, 0, 0, PolicyLRU, 0)
+	require.NoError(t, err)
+	for _, uid := range []string{"a", "b", "c", "d", "e"} {
+		src.Set(uid, &models.Order{OrderUID: uid})
+	}
+
+	n, err := WriteSnapshot(path, src, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	dst, err := NewShardedStorage(4, 0, 0, PolicyLRU, 0)
+	require.NoError(t, err)
+	_, _, err = ReadSnapshot(path, dst.Set)
+	require.NoError(t, err)
+	assert.Equal(t, 5, dst.Len())
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+)
+
+// Stats — снимок статистики кэша
+type Stats struct {
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	HitRatio      float64 `json:"hit_ratio"`
+	Sets          uint64  `json:"sets"`
+	Invalidations uint64  `json:"invalidations"`
+	Evictions     uint64  `json:"evictions"`
+	Expirations   uint64  `json:"expirations"`
+	// -1, если хранилище не сообщает размер
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+
+	Loads      uint64  `json:"loads"`
+	LoadErrors uint64  `json:"load_errors"`
+	LoadAvgMs  float64 `json:"load_avg_ms"`
+	LoadMaxMs  float64 `json:"load_max_ms"`
+}
+
+// StatsProvider — кэш, который ведёт статистику обращений и загрузок из БД
+type StatsProvider interface {
+	Stats() Stats
+	ObserveLoad(d time.Duration, err error)
+}
+
+// InstrumentedCache — обёртка над Cache, считающая попадания, промахи и время загрузок
+type InstrumentedCache struct {
+	Cache
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	sets          atomic.Uint64
+	invalidations atomic.Uint64
+
+	loads      atomic.Uint64
+	loadErrors atomic.Uint64
+	loadTotal  atomic.Int64
+	loadMax    atomic.Int64
+}
+
+// конструктор InstrumentedCache
+func NewInstrumentedCache(cache Cache) *InstrumentedCache {
+	return &InstrumentedCache{Cache: cache}
+}
+
+// получение заказа из кэша с учётом попаданий и промахов
+func (c *InstrumentedCache) Get(orderUID string) (*models.Order, bool) {
+	order, ok := c.Cache.Get(orderUID)
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return order, ok
+}
+
+// готовое JSON-представление заказа с учётом попаданий и промахов
+func (c *InstrumentedCache) GetEncoded(orderUID string) (*Encoded, bool) {
+	enc, ok := c.Cache.GetEncoded(orderUID)
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return enc, ok
+}
+
+func (c *InstrumentedCache) Set(orderUID string, order *models.Order) {
+	c.sets.Add(1)
+	c.Cache.Set(orderUID, order)
+}
+
+func (c *InstrumentedCache) SetWithTTL(orderUID string, order *models.Order, ttl time.Duration) {
+	c.sets.Add(1)
+	c.Cache.SetWithTTL(orderUID, order, ttl)
+}
+
+func (c *InstrumentedCache) Invalidate(orderUID string) {
+	c.invalidations.Add(1)
+	c.Cache.Invalidate(orderUID)
+}
+
+func (c *InstrumentedCache) InvalidateAll() {
+	c.invalidations.Add(1)
+	c.Cache.InvalidateAll()
+}
+
+// учитывает загрузку заказа из источника при промахе кэша
+func (c *InstrumentedCache) ObserveLoad(d time.Duration, err error) {
+	c.loads.Add(1)
+	if err != nil {
+		c.loadErrors.Add(1)
+	}
+	c.loadTotal.Add(int64(d))
+	for {
+		cur := c.loadMax.Load()
+		if int64(d) <= cur || c.loadMax.CompareAndSwap(cur, int64(d)) {
+			return
+		}
+	}
+}
+
+// текущая статистика; размер и вытеснения берутся у обёрнутого хранилища, если оно их сообщает
+func (c *InstrumentedCache) Stats() Stats {
+	st := Stats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Sets:          c.sets.Load(),
+		Invalidations: c.invalidations.Load(),
+		Entries:       -1,
+		Bytes:         -1,
+		Loads:         c.loads.Load(),
+		LoadErrors:    c.loadErrors.Load(),
+		LoadMaxMs:     msFloat(c.loadMax.Load()),
+	}
+	if total := st.Hits + st.Misses; total > 0 {
+		st.HitRatio = float64(st.Hits) / float64(total)
+	}
+	if st.Loads > 0 {
+		st.LoadAvgMs = msFloat(c.loadTotal.Load()) / float64(st.Loads)
+	}
+	if l, ok := c.Cache.(interface{ Len() int }); ok {
+		st.Entries = l.Len()
+	}
+	if b, ok := c.Cache.(interface{ Bytes() int64 }); ok {
+		st.Bytes = b.Bytes()
+	}
+	if e, ok := c.Cache.(interface{ EvictionStats() (uint64, uint64) }); ok {
+		st.Evictions, st.Expirations = e.EvictionStats()
+	}
+	return st
+}
+
+func msFloat(ns int64) float64 {
+	return float64(ns) / float64(time.Millisecond)
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentedCache_Stats(t *testing.T) {
+	bounded, err := NewBoundedStorage(1, 0, PolicyLRU, 0)
+	require.NoError(t, err)
+	cache := NewInstrumentedCache(bounded)
+
+	cache.Set("1", &models.Order{OrderUID: "1"})
+	cache.Set("2", &models.Order{OrderUID: "2"})
+	cache.Get("1")
+	cache.Get("2")
+	cache.Invalidate("2")
+	cache.ObserveLoad(10*time.Millisecond, nil)
+	cache.ObserveLoad(30*time.Millisecond, errors.New("boom"))
+
+	st := cache.Stats()
+	assert.Equal(t, uint64(1), st.Hits)
+	assert.Equal(t, uint64(1), st.Misses)
+	assert.InDelta(t, 0.5, st.HitRatio, 1e-9)
+	assert.Equal(t, uint64(2), st.Sets)
+	assert.Equal(t, uint64(1), st.Invalidations)
+	assert.Equal(t, uint64(1), st.Evictions)
+	assert.Equal(t, 0, st.Entries)
+	assert.Equal(t, int64(0), st.Bytes)
+	assert.Equal(t, uint64(2), st.Loads)
+	assert.Equal(t, uint64(1), st.LoadErrors)
+	assert.InDelta(t, 20.0, st.LoadAvgMs, 1e-9)
+	assert.InDelta(t, 30.0, st.LoadMaxMs, 1e-9)
+}
+
+func TestInstrumentedCache_UnknownSize(t *testing.T) {
+	// встраивание интерфейса скрывает Len/Bytes хранилища
+	cache := NewInstrumentedCache(struct{ Cache }{NewMemoryStorage()})
+	st := cache.Stats()
+	assert.Equal(t, -1, st.Entries)
+	assert.Equal(t, int64(-1), st.Bytes)
+}
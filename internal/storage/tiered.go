@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/models"
+	"go.uber.org/zap"
+)
+
+// TieredStorage — двухуровневый кэш: локальная память реплики перед общим Redis.
+// Изменения рассылаются через pub/sub, и остальные реплики сбрасывают свои локальные копии
+type TieredStorage struct {
+	local  Expirable
+	remote *RedisStorage
+	id     string
+	// паузы между попытками подписаться на инвалидации
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	log        *zap.SugaredLogger
+}
+
+// конструктор TieredStorage
+func NewTieredStorage(local Expirable, remote *RedisStorage, log *zap.SugaredLogger) *TieredStorage {
+	return &TieredStorage{
+		local:      local,
+		remote:     remote,
+		id:         strconv.FormatInt(time.Now().UnixNano(), 36),
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+		log:        log,
+	}
+}
+
+// получение заказа: сначала локально, затем из Redis с заполнением локального уровня
+func (s *TieredStorage) Get(orderUID string) (*models.Order, bool) {
+	if order, ok := s.local.Get(orderUID); ok {
+		return order, true
+	}
+	order, ok := s.remote.Get(orderUID)
+	if ok {
+		s.local.Set(orderUID, order)
+	}
+	return order, ok
+}
+
+// готовое JSON-представление заказа с локального уровня; при промахе заказ подтягивается из Redis
+func (s *TieredStorage) GetEncoded(orderUID string) (*Encoded, bool) {
+	if enc, ok := s.local.GetEncoded(orderUID); ok {
+		return enc, true
+	}
+	order, ok := s.remote.Get(orderUID)
+	if !ok {
+		return nil, false
+	}
+	s.local.Set(orderUID, order)
+	if enc, ok := s.local.GetEncoded(orderUID); ok {
+		return enc, true
+	}
+	enc, err := NewEncoded(order)
+	if err != nil {
+		return nil, false
+	}
+	return enc, true
+}
+
+// добавление или обновление заказа на обоих уровнях
+func (s *TieredStorage) Set(orderUID string, order *models.Order) {
+	s.remote.Set(orderUID, order)
+	s.local.Set(orderUID, order)
+	s.remote.PublishInvalidation(s.id, orderUID)
+}
+
+// добавление или обновление заказа с собственным сроком жизни
+func (s *TieredStorage) SetWithTTL(orderUID string, order *models.Order, ttl time.Duration) {
+	s.remote.SetWithTTL(orderUID, order, ttl)
+	s.local.SetWithTTL(orderUID, order, ttl)
+	s.remote.PublishInvalidation(s.id, orderUID)
+}
+
+// удаление заказа на обоих уровнях и у остальных реплик
+func (s *TieredStorage) Invalidate(orderUID string) {
+	s.remote.Invalidate(orderUID)
+	s.local.Invalidate(orderUID)
+	s.remote.PublishInvalidation(s.id, orderUID)
+}
+
+// очистка кэша на обоих уровнях и у остальных реплик
+func (s *TieredStorage) InvalidateAll() {
+	s.remote.InvalidateAll()
+	s.local.InvalidateAll()
+	s.remote.PublishInvalidation(s.id, "")
+}
+
+// удаляет просроченные записи локального уровня; в Redis записи истекают сами
+func (s *TieredStorage) DeleteExpired() int {
+	return s.local.DeleteExpired()
+}
+
+// возвращает горячие записи локального уровня, срок которых скоро истечёт
+func (s *TieredStorage) ExpiringSoon(within time.Duration) []string {
+	return s.local.ExpiringSoon(within)
+}
+
+// слушает события инвалидации от других реплик до отмены контекста. Пока Redis недоступен,
+// подписка повторяется с растущей паузой; после неудачных попыток локальный уровень очищается:
+// события за это время потеряны
+func (s *TieredStorage) Start(ctx context.Context) {
+	backoff := s.minBackoff
+	failed := false
+	for {
+		events, err := s.remote.Invalidations(ctx)
+		if err == nil {
+			if failed {
+				s.local.InvalidateAll()
+			}
+			s.listen(events)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		failed = true
+		s.log.Warnw("failed to subscribe to cache invalidations, retrying", "err", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, s.maxBackoff)
+	}
+}
+
+// listen применяет события инвалидации, пока канал не закроется
+func (s *TieredStorage) listen(events <-chan Invalidation) {
+	s.log.Info("cache invalidation subscriber started")
+	for ev := range events {
+		if ev.Origin == s.id {
+			continue
+		}
+		if ev.OrderUID == "" {
+			s.local.InvalidateAll()
+			continue
+		}
+		s.local.Invalidate(ev.OrderUID)
+	}
+	s.log.Info("cache invalidation subscriber stopped")
+}
@@ -0,0 +1,45 @@
+-- уведомления об изменении заказов для сброса кэшей реплик;
+-- payload — order_uid, одинаковые уведомления в транзакции Postgres объединяет сам
+CREATE OR REPLACE FUNCTION notify_order_changed() RETURNS trigger AS $$
+DECLARE
+   uid VARCHAR(255);
+BEGIN
+   IF TG_TABLE_NAME IN ('orders', 'items') THEN
+      IF TG_OP = 'DELETE' THEN
+         uid := OLD.order_uid;
+      ELSE
+         uid := NEW.order_uid;
+      END IF;
+      IF uid IS NOT NULL THEN
+         PERFORM pg_notify('order_changed', uid);
+      END IF;
+      -- перенос позиции в другой заказ меняет оба заказа
+      IF TG_TABLE_NAME = 'items' AND TG_OP = 'UPDATE' AND OLD.order_uid IS DISTINCT FROM NEW.order_uid AND OLD.order_uid IS NOT NULL THEN
+         PERFORM pg_notify('order_changed', OLD.order_uid);
+      END IF;
+   ELSIF TG_TABLE_NAME = 'delivery' THEN
+      PERFORM pg_notify('order_changed', o.order_uid) FROM orders o WHERE o.delivery_id = NEW.id;
+   ELSIF TG_TABLE_NAME = 'payment' THEN
+      PERFORM pg_notify('order_changed', o.order_uid) FROM orders o WHERE o.payment_id = NEW.id;
+   END IF;
+   RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- новые заказы попадают в кэш через Kafka, поэтому INSERT не отслеживается;
+-- удаление delivery и payment каскадно удаляет заказ и срабатывает триггер orders
+CREATE TRIGGER orders_notify_changed
+   AFTER UPDATE OR DELETE ON orders
+   FOR EACH ROW EXECUTE FUNCTION notify_order_changed();
+
+CREATE TRIGGER items_notify_changed
+   AFTER UPDATE OR DELETE ON items
+   FOR EACH ROW EXECUTE FUNCTION notify_order_changed();
+
+CREATE TRIGGER delivery_notify_changed
+   AFTER UPDATE ON delivery
+   FOR EACH ROW EXECUTE FUNCTION notify_order_changed();
+
+CREATE TRIGGER payment_notify_changed
+   AFTER UPDATE ON payment
+   FOR EACH ROW EXECUTE FUNCTION notify_order_changed();
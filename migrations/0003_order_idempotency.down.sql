@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS order_versions;
+ALTER TABLE IF EXISTS orders
+   DROP COLUMN IF EXISTS payload_hash,
+   DROP COLUMN IF EXISTS version;
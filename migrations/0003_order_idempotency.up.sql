@@ -0,0 +1,13 @@
+-- хэш принятого сообщения для распознавания повторов и номер версии заказа
+ALTER TABLE orders
+   ADD COLUMN IF NOT EXISTS payload_hash BYTEA,
+   ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+-- прежние версии заказов при политике конфликтов version
+CREATE TABLE IF NOT EXISTS order_versions (
+   order_uid VARCHAR(255) NOT NULL REFERENCES orders(order_uid) ON DELETE CASCADE,
+   version INT NOT NULL,
+   payload JSONB NOT NULL,
+   replaced_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+   PRIMARY KEY (order_uid, version)
+);
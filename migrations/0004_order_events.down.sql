@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS orders
+   DROP COLUMN IF EXISTS status,
+   DROP COLUMN IF EXISTS event_seq;
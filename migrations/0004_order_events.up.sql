@@ -0,0 +1,4 @@
+-- статус заказа и номер последнего применённого события жизненного цикла
+ALTER TABLE orders
+   ADD COLUMN IF NOT EXISTS status VARCHAR(32) NOT NULL DEFAULT 'created',
+   ADD COLUMN IF NOT EXISTS event_seq BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,12 @@
+-- события о сохранённых заказах, записанные в одной транзакции с заказом; их отправляет в Kafka relay
+CREATE TABLE IF NOT EXISTS outbox (
+   id BIGSERIAL PRIMARY KEY,
+   order_uid VARCHAR(255) NOT NULL,
+   event_type VARCHAR(64) NOT NULL,
+   payload JSONB NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+   sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unsent_idx ON outbox (id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_sent_at_idx ON outbox (sent_at) WHERE sent_at IS NOT NULL;
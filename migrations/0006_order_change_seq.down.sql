@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS orders_bump_change_seq ON orders;
+DROP TRIGGER IF EXISTS items_bump_change_seq ON items;
+DROP TRIGGER IF EXISTS delivery_bump_change_seq ON delivery;
+DROP TRIGGER IF EXISTS payment_bump_change_seq ON payment;
+DROP FUNCTION IF EXISTS bump_order_change_seq();
+ALTER TABLE IF EXISTS orders DROP COLUMN IF EXISTS change_seq;
+DROP SEQUENCE IF EXISTS orders_change_seq;
@@ -0,0 +1,50 @@
+-- номер последнего изменения заказа из общей последовательности; по нему при запуске из снимка кэша
+-- догружаются заказы, изменённые после снимка (date_created задаёт продюсер, и изменений она не отражает)
+CREATE SEQUENCE IF NOT EXISTS orders_change_seq;
+
+ALTER TABLE orders
+   ADD COLUMN IF NOT EXISTS change_seq BIGINT NOT NULL DEFAULT nextval('orders_change_seq');
+
+CREATE INDEX IF NOT EXISTS orders_change_seq_idx ON orders (change_seq);
+
+CREATE OR REPLACE FUNCTION bump_order_change_seq() RETURNS trigger AS $$
+BEGIN
+   IF TG_TABLE_NAME = 'orders' THEN
+      -- номер, уже выданный триггером позиций, доставки или оплаты, не меняется
+      IF NEW.change_seq IS NOT DISTINCT FROM OLD.change_seq THEN
+         NEW.change_seq := nextval('orders_change_seq');
+      END IF;
+      RETURN NEW;
+   ELSIF TG_TABLE_NAME = 'items' THEN
+      IF TG_OP = 'DELETE' THEN
+         UPDATE orders SET change_seq = nextval('orders_change_seq') WHERE order_uid = OLD.order_uid;
+      ELSE
+         UPDATE orders SET change_seq = nextval('orders_change_seq')
+            WHERE order_uid = NEW.order_uid OR order_uid = OLD.order_uid;
+      END IF;
+   ELSIF TG_TABLE_NAME = 'delivery' THEN
+      UPDATE orders SET change_seq = nextval('orders_change_seq') WHERE delivery_id = NEW.id;
+   ELSIF TG_TABLE_NAME = 'payment' THEN
+      UPDATE orders SET change_seq = nextval('orders_change_seq') WHERE payment_id = NEW.id;
+   END IF;
+   RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- новый заказ получает номер по умолчанию; позиции вставляются вместе с заказом,
+-- поэтому, как и для уведомлений, INSERT в items не отслеживается
+CREATE TRIGGER orders_bump_change_seq
+   BEFORE UPDATE ON orders
+   FOR EACH ROW EXECUTE FUNCTION bump_order_change_seq();
+
+CREATE TRIGGER items_bump_change_seq
+   AFTER UPDATE OR DELETE ON items
+   FOR EACH ROW EXECUTE FUNCTION bump_order_change_seq();
+
+CREATE TRIGGER delivery_bump_change_seq
+   AFTER UPDATE ON delivery
+   FOR EACH ROW EXECUTE FUNCTION bump_order_change_seq();
+
+CREATE TRIGGER payment_bump_change_seq
+   AFTER UPDATE ON payment
+   FOR EACH ROW EXECUTE FUNCTION bump_order_change_seq();
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS outbox
+   DROP COLUMN IF EXISTS claimed_until;
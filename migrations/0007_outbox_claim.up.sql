@@ -0,0 +1,3 @@
+-- до claimed_until событие отправляет забравшая его реплика; блокировки строк на время записи в Kafka не держатся
+ALTER TABLE outbox
+   ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ;
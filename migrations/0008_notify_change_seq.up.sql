@@ -0,0 +1,39 @@
+-- payload уведомления — order_uid:change_seq, чтобы кэш пропускал изменения, которые уже видел.
+-- Изменения одного заказа упорядочены блокировкой его строки в orders, поэтому change_seq растёт в порядке
+-- фиксации. Триггеры *_bump_change_seq срабатывают раньше *_notify_changed (по имени), и уведомление
+-- получает уже новый номер; одинаковые уведомления триггеров позиции и заказа Postgres объединяет
+CREATE OR REPLACE FUNCTION notify_order_changed() RETURNS trigger AS $$
+DECLARE
+   uid VARCHAR(255);
+   seq BIGINT;
+BEGIN
+   IF TG_TABLE_NAME = 'orders' THEN
+      IF TG_OP = 'DELETE' THEN
+         -- удаление новее любого изменения заказа
+         PERFORM pg_notify('order_changed', OLD.order_uid || ':' || nextval('orders_change_seq'));
+      ELSE
+         PERFORM pg_notify('order_changed', NEW.order_uid || ':' || NEW.change_seq);
+      END IF;
+   ELSIF TG_TABLE_NAME = 'items' THEN
+      IF TG_OP = 'DELETE' THEN
+         uid := OLD.order_uid;
+      ELSE
+         uid := NEW.order_uid;
+      END IF;
+      -- при каскадном удалении заказа строки уже нет, уведомление отправил триггер orders
+      SELECT o.change_seq INTO seq FROM orders o WHERE o.order_uid = uid;
+      IF seq IS NOT NULL THEN
+         PERFORM pg_notify('order_changed', uid || ':' || seq);
+      END IF;
+      -- перенос позиции в другой заказ меняет оба заказа
+      IF TG_OP = 'UPDATE' AND OLD.order_uid IS DISTINCT FROM NEW.order_uid AND OLD.order_uid IS NOT NULL THEN
+         PERFORM pg_notify('order_changed', o.order_uid || ':' || o.change_seq) FROM orders o WHERE o.order_uid = OLD.order_uid;
+      END IF;
+   ELSIF TG_TABLE_NAME = 'delivery' THEN
+      PERFORM pg_notify('order_changed', o.order_uid || ':' || o.change_seq) FROM orders o WHERE o.delivery_id = NEW.id;
+   ELSIF TG_TABLE_NAME = 'payment' THEN
+      PERFORM pg_notify('order_changed', o.order_uid || ':' || o.change_seq) FROM orders o WHERE o.payment_id = NEW.id;
+   END IF;
+   RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,29 @@
+DROP TRIGGER IF EXISTS orders_record_tombstone ON orders;
+DROP FUNCTION IF EXISTS record_order_tombstone();
+DROP TABLE IF EXISTS order_tombstones;
+ALTER TABLE IF EXISTS orders DROP COLUMN IF EXISTS change_xid;
+
+-- прежняя функция без change_xid (migrations/0006_order_change_seq)
+CREATE OR REPLACE FUNCTION bump_order_change_seq() RETURNS trigger AS $$
+BEGIN
+   IF TG_TABLE_NAME = 'orders' THEN
+      -- номер, уже выданный триггером позиций, доставки или оплаты, не меняется
+      IF NEW.change_seq IS NOT DISTINCT FROM OLD.change_seq THEN
+         NEW.change_seq := nextval('orders_change_seq');
+      END IF;
+      RETURN NEW;
+   ELSIF TG_TABLE_NAME = 'items' THEN
+      IF TG_OP = 'DELETE' THEN
+         UPDATE orders SET change_seq = nextval('orders_change_seq') WHERE order_uid = OLD.order_uid;
+      ELSE
+         UPDATE orders SET change_seq = nextval('orders_change_seq')
+            WHERE order_uid = NEW.order_uid OR order_uid = OLD.order_uid;
+      END IF;
+   ELSIF TG_TABLE_NAME = 'delivery' THEN
+      UPDATE orders SET change_seq = nextval('orders_change_seq') WHERE delivery_id = NEW.id;
+   ELSIF TG_TABLE_NAME = 'payment' THEN
+      UPDATE orders SET change_seq = nextval('orders_change_seq') WHERE payment_id = NEW.id;
+   END IF;
+   RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
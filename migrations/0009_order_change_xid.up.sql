@@ -0,0 +1,55 @@
+-- номера change_seq выдаются до фиксации транзакций и не упорядочены по ней, поэтому отметкой снимка кэша служит
+-- xmin снимка транзакций (pg_snapshot_xmin): транзакции с меньшим номером уже завершены. change_xid — номер
+-- транзакции, последней изменившей заказ; при запуске из снимка догружаются заказы с change_xid не меньше отметки
+ALTER TABLE orders
+   ADD COLUMN IF NOT EXISTS change_xid xid8 NOT NULL DEFAULT pg_current_xact_id();
+
+CREATE INDEX IF NOT EXISTS orders_change_xid_idx ON orders (change_xid);
+
+-- изменения позиций, доставки и оплаты доходят до заказа через UPDATE orders SET change_seq (migrations/0006)
+CREATE OR REPLACE FUNCTION bump_order_change_seq() RETURNS trigger AS $$
+BEGIN
+   IF TG_TABLE_NAME = 'orders' THEN
+      -- номер, уже выданный триггером позиций, доставки или оплаты, не меняется
+      IF NEW.change_seq IS NOT DISTINCT FROM OLD.change_seq THEN
+         NEW.change_seq := nextval('orders_change_seq');
+      END IF;
+      NEW.change_xid := pg_current_xact_id();
+      RETURN NEW;
+   ELSIF TG_TABLE_NAME = 'items' THEN
+      IF TG_OP = 'DELETE' THEN
+         UPDATE orders SET change_seq = nextval('orders_change_seq') WHERE order_uid = OLD.order_uid;
+      ELSE
+         UPDATE orders SET change_seq = nextval('orders_change_seq')
+            WHERE order_uid = NEW.order_uid OR order_uid = OLD.order_uid;
+      END IF;
+   ELSIF TG_TABLE_NAME = 'delivery' THEN
+      UPDATE orders SET change_seq = nextval('orders_change_seq') WHERE delivery_id = NEW.id;
+   ELSIF TG_TABLE_NAME = 'payment' THEN
+      UPDATE orders SET change_seq = nextval('orders_change_seq') WHERE payment_id = NEW.id;
+   END IF;
+   RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- удалённые заказы: по ним при запуске из снимка из кэша убираются заказы, которых в БД больше нет.
+-- На каждый order_uid хранится одна запись — о последнем удалении
+CREATE TABLE IF NOT EXISTS order_tombstones (
+   order_uid VARCHAR(255) PRIMARY KEY,
+   change_xid xid8 NOT NULL DEFAULT pg_current_xact_id(),
+   deleted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS order_tombstones_change_xid_idx ON order_tombstones (change_xid);
+
+CREATE OR REPLACE FUNCTION record_order_tombstone() RETURNS trigger AS $$
+BEGIN
+   INSERT INTO order_tombstones (order_uid) VALUES (OLD.order_uid)
+      ON CONFLICT (order_uid) DO UPDATE SET change_xid = EXCLUDED.change_xid, deleted_at = EXCLUDED.deleted_at;
+   RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER orders_record_tombstone
+   AFTER DELETE ON orders
+   FOR EACH ROW EXECUTE FUNCTION record_order_tombstone();
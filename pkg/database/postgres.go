@@ -18,9 +18,9 @@ func (s *Storage) Close() {
 	}
 }
 
-// создает новый пул соединений с Postgres по заданной конфигурации
-func NewPostgres(ctx context.Context, cfg config.Postgres) (*Storage, error) {
-	connStr := fmt.Sprintf(
+// строка подключения к Postgres по заданной конфигурации
+func ConnString(cfg config.Postgres) string {
+	return fmt.Sprintf(
 		"postgres://%s:%s@%s:%d/%s",
 		cfg.User,
 		cfg.Password,
@@ -28,8 +28,11 @@ func NewPostgres(ctx context.Context, cfg config.Postgres) (*Storage, error) {
 		cfg.Port,
 		cfg.DBName,
 	)
+}
 
-	pool, err := pgxpool.Connect(ctx, connStr)
+// создает новый пул соединений с Postgres по заданной конфигурации
+func NewPostgres(ctx context.Context, cfg config.Postgres) (*Storage, error) {
+	pool, err := pgxpool.Connect(ctx, ConnString(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
@@ -0,0 +1,23 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// создает клиента Redis по заданной конфигурации и проверяет соединение
+func NewRedis(ctx context.Context, cfg config.Redis) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("unable to ping redis: %w", err)
+	}
+	return client, nil
+}
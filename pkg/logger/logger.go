@@ -1,17 +1,85 @@
 package logger
 
 import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type Logger struct {
 	*zap.SugaredLogger
 }
 
-func NewLogger() (*zap.SugaredLogger, error) {
-	logger, err := zap.NewProduction()
+// NewLogger создаёт логгер по настройкам cfg; уровень можно менять во время работы через возвращаемый AtomicLevel.
+// Персональные данные в записях маскирует redact (см. Redact); nil — без маскирования
+func NewLogger(cfg config.Log, redact func(string) string) (*zap.SugaredLogger, zap.AtomicLevel, error) {
+	level, err := zap.ParseAtomicLevel(cfg.Level)
+	if err != nil {
+		return nil, zap.AtomicLevel{}, fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	}
+	zcfg := zap.NewProductionConfig()
+	zcfg.Level = level
+	switch cfg.Encoding {
+	case "json":
+	case "console":
+		zcfg.Encoding = "console"
+		zcfg.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, zap.AtomicLevel{}, fmt.Errorf("unknown log encoding %q", cfg.Encoding)
+	}
+	// выборка ставится поверх маскирования персональных данных, поэтому собирается здесь, а не в zcfg
+	zcfg.Sampling = nil
+	wrap := zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if redact != nil {
+			core = Redact(core, redact)
+		}
+		// после initial одинаковых записей за секунду пишется только каждая thereafter-я; initial 0 — без выборки
+		if cfg.Sampling.Initial > 0 {
+			core = zapcore.NewSamplerWithOptions(core, time.Second, cfg.Sampling.Initial, cfg.Sampling.Thereafter)
+		}
+		return core
+	})
+
+	logger, err := zcfg.Build(wrap)
 	if err != nil {
-		return nil, err
+		return nil, zap.AtomicLevel{}, err
+	}
+	return logger.Sugar(), level, nil
+}
+
+type ctxKey struct{}
+
+// WithContext сохраняет логгер в контексте
+func WithContext(ctx context.Context, log *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, log)
+}
+
+// With добавляет поля к логгеру контекста; без логгера в контексте возвращает ctx как есть
+func With(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	log, ok := ctx.Value(ctxKey{}).(*zap.SugaredLogger)
+	if !ok {
+		return ctx
+	}
+	return WithContext(ctx, log.With(keysAndValues...))
+}
+
+// FromContext — логгер контекста (или fallback, если его нет) с trace_id и span_id текущего спана.
+// При nil fallback и пустом контексте записи отбрасываются
+func FromContext(ctx context.Context, fallback *zap.SugaredLogger) *zap.SugaredLogger {
+	log, ok := ctx.Value(ctxKey{}).(*zap.SugaredLogger)
+	if !ok {
+		log = fallback
+	}
+	if log == nil {
+		return zap.NewNop().Sugar()
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		return log.With("trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
 	}
-	return logger.Sugar(), nil
+	return log
 }
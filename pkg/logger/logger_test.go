@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNewLogger(t *testing.T) {
+	log, level, err := NewLogger(config.Log{Level: "warn", Encoding: "console"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, zapcore.WarnLevel, level.Level())
+	assert.False(t, log.Desugar().Core().Enabled(zapcore.InfoLevel))
+
+	// уровень меняется во время работы
+	level.SetLevel(zapcore.DebugLevel)
+	assert.True(t, log.Desugar().Core().Enabled(zapcore.DebugLevel))
+
+	_, _, err = NewLogger(config.Log{Level: "loud", Encoding: "json"}, nil)
+	assert.Error(t, err)
+	_, _, err = NewLogger(config.Log{Level: "info", Encoding: "xml"}, nil)
+	assert.Error(t, err)
+}
+
+func TestFromContext(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	base := zap.New(core).Sugar()
+
+	ctx := WithContext(context.Background(), base.With("req_id", "r1"))
+	ctx = With(ctx, "order_uid", "abc")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{2},
+	})
+	FromContext(trace.ContextWithSpanContext(ctx, sc), nil).Info("hello")
+
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "r1", fields["req_id"])
+	assert.Equal(t, "abc", fields["order_uid"])
+	assert.Equal(t, sc.TraceID().String(), fields["trace_id"])
+	assert.Equal(t, sc.SpanID().String(), fields["span_id"])
+
+	// без логгера в контексте используется fallback, With ничего не добавляет
+	FromContext(With(context.Background(), "order_uid", "abc"), base).Info("fallback")
+	assert.Empty(t, logs.All()[1].ContextMap())
+	assert.NotPanics(t, func() { FromContext(context.Background(), nil).Info("dropped") })
+}
+
+func TestRedact(t *testing.T) {
+	// маскирование подставляется извне; здесь проверяется, что оно применяется ко всем частям записи
+	redact := strings.NewReplacer("+79161231234", "+7******1234", "test@gmail.com", "t***@gmail.com",
+		"Test Testov", "T*** T***").Replace
+	core, logs := observer.New(zapcore.DebugLevel)
+	log := zap.New(Redact(core, redact)).Sugar().With("phone", "+79161231234")
+
+	type delivery struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	log.Warnw("invalid json for test@gmail.com",
+		"raw", `{"delivery":{"name":"Test Testov","phone":"+79161231234"`,
+		"err", errors.New("bad email test@gmail.com"),
+		"delivery", delivery{Name: "Test Testov", Email: "test@gmail.com"},
+		"order_uid", "b563feb7b2b84b6test",
+	)
+
+	require.Equal(t, 1, logs.Len())
+	entry := logs.All()[0]
+	assert.Equal(t, "invalid json for t***@gmail.com", entry.Message)
+	fields := entry.ContextMap()
+	assert.Equal(t, "+7******1234", fields["phone"])
+	assert.Equal(t, `{"delivery":{"name":"T*** T***","phone":"+7******1234"`, fields["raw"])
+	assert.Equal(t, "bad email t***@gmail.com", fields["err"])
+	assert.Equal(t, json.RawMessage(`{"name":"T*** T***","email":"t***@gmail.com"}`), fields["delivery"])
+	assert.Equal(t, "b563feb7b2b84b6test", fields["order_uid"])
+}
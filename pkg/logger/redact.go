@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"encoding/json"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redact оборачивает core так, что redact маскирует персональные данные во всех записях:
+// в сообщении, строковых полях, ошибках и структурах (например, заказе), переданных полем.
+// redact возвращает строку без изменений, если маскировать нечего
+func Redact(core zapcore.Core, redact func(string) string) zapcore.Core {
+	return redactCore{Core: core, redact: redact}
+}
+
+type redactCore struct {
+	zapcore.Core
+	redact func(string) string
+}
+
+func (c redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactCore{Core: c.Core.With(c.redactFields(fields)), redact: c.redact}
+}
+
+func (c redactCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c redactCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	e.Message = c.redact(e.Message)
+	return c.Core.Write(e, c.redactFields(fields))
+}
+
+// redactFields копирует срез полей, только если что-то пришлось замаскировать
+func (c redactCore) redactFields(fields []zapcore.Field) []zapcore.Field {
+	out := fields
+	for i, f := range fields {
+		r, ok := c.redactField(f)
+		if !ok {
+			continue
+		}
+		if &out[0] == &fields[0] {
+			out = append([]zapcore.Field(nil), fields...)
+		}
+		out[i] = r
+	}
+	return out
+}
+
+// redactField возвращает замаскированное поле и true, если в нём нашлись персональные данные
+func (c redactCore) redactField(f zapcore.Field) (zapcore.Field, bool) {
+	switch f.Type {
+	case zapcore.StringType:
+		if s := c.redact(f.String); s != f.String {
+			f.String = s
+			return f, true
+		}
+	case zapcore.ByteStringType:
+		if b, ok := f.Interface.([]byte); ok {
+			if s := c.redact(string(b)); s != string(b) {
+				return zap.ByteString(f.Key, []byte(s)), true
+			}
+		}
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok && err != nil {
+			msg := err.Error()
+			if s := c.redact(msg); s != msg {
+				return zap.String(f.Key, s), true
+			}
+		}
+	case zapcore.ReflectType:
+		// структуры маскируются в JSON-представлении, в котором их и запишет кодировщик
+		b, err := json.Marshal(f.Interface)
+		if err != nil {
+			return f, false
+		}
+		if s := c.redact(string(b)); s != string(b) {
+			return zap.Reflect(f.Key, json.RawMessage(s)), true
+		}
+	}
+	return f, false
+}
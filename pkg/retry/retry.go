@@ -0,0 +1,78 @@
+// Package retry — повтор операций с экспоненциальной задержкой и случайным разбросом
+package retry
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/MikhaylovMaks/wb_techl0/internal/config"
+)
+
+// Policy описывает, сколько раз и с какими паузами повторять операцию
+type Policy struct {
+	// общее число попыток, включая первую; значения меньше 1 означают одну попытку
+	MaxAttempts int
+	// пауза перед первым повтором; дальше удваивается, но не превышает MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// доля паузы, на которую она случайно уменьшается (0 — без разброса, 1 — от 0 до полной паузы)
+	Jitter float64
+	// Retryable решает, имеет ли смысл повторять после ошибки; nil — повторять любую
+	Retryable func(error) bool
+	// OnRetry вызывается перед паузой очередного повтора
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// политика из настроек сервиса
+func FromConfig(cfg config.Retry, retryable func(error) bool) Policy {
+	return Policy{
+		MaxAttempts: cfg.MaxAttempts,
+		BaseDelay:   cfg.BaseDelay,
+		MaxDelay:    cfg.MaxDelay,
+		Jitter:      cfg.Jitter,
+		Retryable:   retryable,
+	}
+}
+
+// Do выполняет fn, пока она не завершится успешно, не вернёт неповторяемую ошибку,
+// не кончатся попытки или не отменится контекст. Возвращает число сделанных попыток и последнюю ошибку
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) (int, error) {
+	attempts := max(p.MaxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return attempt, nil
+		}
+		if attempt >= attempts || ctx.Err() != nil || (p.Retryable != nil && !p.Retryable(err)) {
+			return attempt, err
+		}
+
+		delay := p.Delay(attempt)
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+	}
+}
+
+// Delay — пауза после attempt-й неудачной попытки
+func (p Policy) Delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if j := min(max(p.Jitter, 0), 1); j > 0 && d > 0 {
+		d -= time.Duration(rand.Float64() * j * float64(d))
+	}
+	return d
+}
@@ -0,0 +1,80 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTemporary = errors.New("temporary")
+
+func TestPolicy_RetriesUntilSuccess(t *testing.T) {
+	p := Policy{MaxAttempts: 5, BaseDelay: time.Millisecond}
+	var calls int
+	attempts, err := p.Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errTemporary
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 3, calls)
+}
+
+func TestPolicy_StopsAfterMaxAttempts(t *testing.T) {
+	var retries []int
+	p := Policy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		OnRetry:     func(attempt int, _ error, _ time.Duration) { retries = append(retries, attempt) },
+	}
+	attempts, err := p.Do(context.Background(), func(context.Context) error { return errTemporary })
+	assert.ErrorIs(t, err, errTemporary)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []int{1, 2}, retries)
+}
+
+func TestPolicy_PermanentErrorIsNotRetried(t *testing.T) {
+	permanent := errors.New("permanent")
+	p := Policy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Millisecond,
+		Retryable:   func(err error) bool { return !errors.Is(err, permanent) },
+	}
+	attempts, err := p.Do(context.Background(), func(context.Context) error { return permanent })
+	assert.ErrorIs(t, err, permanent)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestPolicy_StopsOnContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Policy{MaxAttempts: 10, BaseDelay: time.Hour}
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	attempts, err := p.Do(ctx, func(context.Context) error { return errTemporary })
+	assert.ErrorIs(t, err, errTemporary)
+	assert.Equal(t, 1, attempts)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestPolicy_Delay(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	assert.Equal(t, 100*time.Millisecond, p.Delay(1))
+	assert.Equal(t, 200*time.Millisecond, p.Delay(2))
+	assert.Equal(t, 800*time.Millisecond, p.Delay(4))
+	assert.Equal(t, time.Second, p.Delay(5))
+	assert.Equal(t, time.Second, p.Delay(100))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.Delay(2)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.LessOrEqual(t, d, 200*time.Millisecond)
+	}
+}